@@ -3,9 +3,12 @@ package async
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/ayonli/goext/clock"
 	"github.com/ayonli/goext/slicex"
 )
 
@@ -20,6 +23,45 @@ type indexedResult[R any] struct {
 	result WaitResult[R]
 }
 
+// AggregateError groups the errors of several functions into a single error, the errors are kept
+// in the order of the functions that return them.
+//
+// AggregateError implements `Unwrap() []error`, so `errors.Is()` and `errors.As()` check each of
+// the errors it holds.
+type AggregateError struct {
+	Errors []error
+}
+
+func (err *AggregateError) Error() string {
+	var builder strings.Builder
+
+	if len(err.Errors) == 0 {
+		return "no function succeeded"
+	} else if len(err.Errors) == 1 {
+		builder.WriteString("1 error occurred:")
+	} else {
+		builder.WriteString(fmt.Sprintf("%d errors occurred:", len(err.Errors)))
+	}
+
+	for i, _err := range err.Errors {
+		msg := "<nil>"
+
+		if _err != nil {
+			msg = _err.Error()
+		}
+
+		// indent the following lines of a multi-line message so that they stay in the entry
+		msg = strings.ReplaceAll(msg, "\n", "\n    ")
+		builder.WriteString(fmt.Sprintf("\n  [%d] %s", i, msg))
+	}
+
+	return builder.String()
+}
+
+func (err *AggregateError) Unwrap() []error {
+	return err.Errors
+}
+
 // Wait runs the given function in another goroutine and waits its return value.
 func Wait[R any](fn func() (R, error)) (R, error) {
 	channel := make(chan WaitResult[R])
@@ -87,6 +129,22 @@ func WaitAny[F func() (R, error), R any](fns ...F) (R, []error) {
 	})
 }
 
+// WaitAnyAggregate is like `WaitAny()`, except if all functions failed, the errors are returned as
+// an `*AggregateError`, so that they can be passed on as an ordinary error and inspected with
+// `errors.Is()` and `errors.As()`.
+//
+// If no function is given, an `*AggregateError` without errors is returned, since none of them
+// succeeds.
+func WaitAnyAggregate[F func() (R, error), R any](fns ...F) (R, error) {
+	value, errs := WaitAny(fns...)
+
+	if len(fns) == 0 || len(errs) > 0 {
+		return value, &AggregateError{Errors: errs}
+	}
+
+	return value, nil
+}
+
 // WaitAll runs a series of functions in different goroutines and wait for all return successfully
 // or anyone fails.
 //
@@ -152,12 +210,157 @@ func WaitAllSettled[F func() (R, error), R any](fns ...F) []WaitResult[R] {
 	return results
 }
 
+// runLimit runs the functions in different goroutines with at most `limit` of them running at the
+// same time, and returns the results ordered accordingly. If `failFast` is set, it stops starting
+// new functions and returns the error once anyone fails.
+func runLimit[F func() (R, error), R any](limit int, fns []F, failFast bool) ([]WaitResult[R], error) {
+	total := len(fns)
+	channel := make(chan indexedResult[R], total)
+	results := make([]WaitResult[R], total)
+	next := 0
+	running := 0
+
+	if limit <= 0 || limit > total {
+		limit = total
+	}
+
+	for next < total || running > 0 {
+		for running < limit && next < total {
+			go func(fn F, i int) {
+				res, err := fn()
+				channel <- indexedResult[R]{
+					index:  i,
+					result: WaitResult[R]{Value: res, Error: err},
+				}
+			}(fns[next], next)
+
+			next++
+			running++
+		}
+
+		res := <-channel
+		running--
+
+		if failFast && res.result.Error != nil {
+			return nil, res.result.Error
+		}
+
+		results[res.index] = res.result
+	}
+
+	return results, nil
+}
+
+// WaitAllLimit is like `WaitAll()`, except at most `limit` functions run at the same time, and
+// once anyone fails, the functions that haven't started are skipped. If `limit` is not positive,
+// all functions run at the same time.
+func WaitAllLimit[F func() (R, error), R any](limit int, fns ...F) ([]R, error) {
+	results, err := runLimit(limit, fns, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return slicex.Map(results, func(item WaitResult[R], _ int) R {
+		return item.Value
+	}), nil
+}
+
+// WaitAllSettledLimit is like `WaitAllSettled()`, except at most `limit` functions run at the same
+// time. If `limit` is not positive, all functions run at the same time.
+func WaitAllSettledLimit[F func() (R, error), R any](limit int, fns ...F) []WaitResult[R] {
+	results, _ := runLimit(limit, fns, false)
+	return results
+}
+
+// ParallelMap calls the `fn` function on every item of the slice in different goroutines with at
+// most `limit` of them running at the same time, and returns the results ordered as the items.
+// Once any call fails, the items that haven't been started are skipped and the error is returned.
+// If `limit` is not positive, all calls run at the same time.
+func ParallelMap[S ~[]T, T any, R any](
+	items S,
+	limit int,
+	fn func(item T, idx int) (R, error),
+) ([]R, error) {
+	return WaitAllLimit(limit, slicex.Map(items, func(item T, idx int) func() (R, error) {
+		return func() (R, error) { return fn(item, idx) }
+	})...)
+}
+
+// WaitRaceContext is like `WaitRace()`, except the functions receive a context derived from `ctx`,
+// which is canceled once anyone of them returns, so that the others can stop early.
+func WaitRaceContext[F func(ctx context.Context) (R, error), R any](
+	ctx context.Context,
+	fns ...F,
+) (R, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	return WaitRace(slicex.Map(fns, func(fn F, _ int) func() (R, error) {
+		return func() (R, error) { return fn(ctx) }
+	})...)
+}
+
+// WaitAnyContext is like `WaitAny()`, except the functions receive a context derived from `ctx`,
+// which is canceled once anyone of them returns successfully, so that the others can stop early.
+func WaitAnyContext[F func(ctx context.Context) (R, error), R any](
+	ctx context.Context,
+	fns ...F,
+) (R, []error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	return WaitAny(slicex.Map(fns, func(fn F, _ int) func() (R, error) {
+		return func() (R, error) { return fn(ctx) }
+	})...)
+}
+
+// WaitAllContext is like `WaitAll()`, except the functions receive a context derived from `ctx`,
+// which is canceled once anyone of them fails, so that the others can stop early.
+func WaitAllContext[F func(ctx context.Context) (R, error), R any](
+	ctx context.Context,
+	fns ...F,
+) ([]R, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	return WaitAll(slicex.Map(fns, func(fn F, _ int) func() (R, error) {
+		return func() (R, error) { return fn(ctx) }
+	})...)
+}
+
+// Option configures the timing functions such as `WaitTimeout()`.
+type Option func(options *waitOptions)
+
+type waitOptions struct {
+	clock clock.Clock
+}
+
+// WithClock sets the clock used by the timing functions, default `clock.Real()`. A fake clock can
+// be used in tests to control the timing without waiting for the real time to pass.
+func WithClock(c clock.Clock) Option {
+	return func(options *waitOptions) {
+		options.clock = c
+	}
+}
+
+func resolveOptions(opts []Option) waitOptions {
+	options := waitOptions{}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	options.clock = clock.Or(options.clock)
+	return options
+}
+
 // WaitTimeout runs the given function in another goroutine and shall return its result before the
-// timeout limit.
-func WaitTimeout[R any](fn func() (R, error), duration time.Duration) (R, error) {
+// timeout limit, otherwise, `context.DeadlineExceeded` is returned.
+func WaitTimeout[R any](fn func() (R, error), duration time.Duration, opts ...Option) (R, error) {
 	channel := make(chan WaitResult[R], 1)
-	ctx, cancel := context.WithTimeout(context.Background(), duration)
-	defer cancel()
+	timer := resolveOptions(opts).clock.NewTimer(duration)
+	defer timer.Stop()
 
 	go func() {
 		res, err := fn()
@@ -167,35 +370,100 @@ func WaitTimeout[R any](fn func() (R, error), duration time.Duration) (R, error)
 	select {
 	case res := <-channel:
 		return res.Value, res.Error
-	case <-ctx.Done():
-		return *new(R), ctx.Err()
+	case <-timer.C():
+		return *new(R), context.DeadlineExceeded
 	}
 }
 
 // WaitAfter runs the given function in another goroutine and returns its result only after the
 // given duration.
-func WaitAfter[R any](fn func() (R, error), duration time.Duration) (R, error) {
+func WaitAfter[R any](fn func() (R, error), duration time.Duration, opts ...Option) (R, error) {
+	clk := resolveOptions(opts).clock
 	results := WaitAllSettled(fn, func() (R, error) {
-		time.Sleep(duration)
+		clk.Sleep(duration)
 		return *new(R), nil
 	})
 	result := results[0]
 	return result.Value, result.Error
 }
 
-// Blocks the context until the test is passed.
-func WaitUntil(test func() bool) {
-	pass := make(chan bool)
+// Blocks the context until the test is passed, the test is checked every millisecond.
+//
+// WaitUntil never gives up, use `WaitUntilContext()` to wait with a timeout or a context.
+func WaitUntil(test func() bool, opts ...Option) {
+	WaitUntilContext(context.Background(), test, WaitUntilOptions{}, opts...)
+}
+
+// WaitUntilOptions configures how `WaitUntilContext()` checks the test.
+type WaitUntilOptions struct {
+	// Timeout is the maximum time to wait, if not set, the waiting is only limited by the context.
+	Timeout time.Duration
+	// Interval is the duration between two checks, default 1 millisecond. It is ignored if Backoff
+	// is set.
+	Interval time.Duration
+	// Backoff computes the duration between two checks, so that the test is checked less often the
+	// longer it fails, for example, `ExponentialBackoff(time.Millisecond, 2)`.
+	Backoff Backoff
+	// MaxInterval caps the duration returned by Backoff, if not set, the duration is not capped.
+	MaxInterval time.Duration
+}
 
-	go func() {
-		for !test() {
-			time.Sleep(time.Millisecond)
+// WaitUntilContext blocks until the test is passed, or the context is canceled or its deadline
+// exceeds, in which case the context's error is returned. If `options.Timeout` is set and the test
+// is not passed by then, `context.DeadlineExceeded` is returned.
+//
+// The test is checked in the calling goroutine, first immediately, then every `options.Interval`
+// or by `options.Backoff`, the waiting honors the clock set by `WithClock()`.
+func WaitUntilContext(
+	ctx context.Context,
+	test func() bool,
+	options WaitUntilOptions,
+	opts ...Option,
+) error {
+	clk := resolveOptions(opts).clock
+	var deadline <-chan time.Time
+
+	if options.Timeout > 0 {
+		timer := clk.NewTimer(options.Timeout)
+		defer timer.Stop()
+		deadline = timer.C()
+	}
+
+	interval := options.Interval
+
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+
+	delay := time.Duration(0)
+
+	for checks := 1; ; checks++ {
+		if test() {
+			return nil
 		}
 
-		pass <- true
-	}()
+		if options.Backoff != nil {
+			delay = options.Backoff(checks, delay)
 
-	<-pass
+			if options.MaxInterval > 0 && delay > options.MaxInterval {
+				delay = options.MaxInterval
+			}
+		} else {
+			delay = interval
+		}
+
+		timer := clk.NewTimer(delay)
+
+		select {
+		case <-timer.C():
+		case <-deadline:
+			timer.Stop()
+			return context.DeadlineExceeded
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
 }
 
 // Queue processes data sequentially by the given callback function that prevents concurrency
@@ -220,64 +488,285 @@ func Queue[T any](callback func(data T) (fin bool)) func(data T) {
 	}
 }
 
+// TaskState is the state of an `AsyncTask`.
+type TaskState int
+
+const (
+	// TaskPending means the task hasn't been settled yet.
+	TaskPending TaskState = iota
+	// TaskFulfilled means the task has been resolved with a value.
+	TaskFulfilled
+	// TaskRejected means the task has been rejected with an error.
+	TaskRejected
+	// TaskCanceled means the task has been canceled by `AsyncTask.Cancel()`.
+	TaskCanceled
+)
+
+func (state TaskState) String() string {
+	switch state {
+	case TaskPending:
+		return "pending"
+	case TaskFulfilled:
+		return "fulfilled"
+	case TaskRejected:
+		return "rejected"
+	case TaskCanceled:
+		return "canceled"
+	default:
+		return "unknown"
+	}
+}
+
 // AsyncTask represents the eventual completion (or failure) of an asynchronous operation and
 // its resulting value.
 //
 // Unlike channel, whose value can be consumed only once, AsyncTask caches the result so that
 // it can be retrieved as many times as we want.
+//
+// The zero value is a pending task ready to use.
 type AsyncTask[T any] struct {
 	result *WaitResult[T]
-	queue  []chan bool
+	state  TaskState
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelCauseFunc
 	mu     sync.Mutex
 }
 
-// Resolve settles the task successfully with a given value.
-func (task *AsyncTask[T]) Resolve(value T) {
+// init creates the done channel if it doesn't exist yet, the caller must hold the lock.
+func (task *AsyncTask[T]) init() {
+	if task.done == nil {
+		task.done = make(chan struct{})
+	}
+}
+
+// cause returns the cause to cancel the producer-side context with, the caller must hold the lock.
+func (task *AsyncTask[T]) cause() error {
+	if task.state == TaskCanceled {
+		return task.result.Error
+	}
+
+	return nil
+}
+
+// finish settles the task with the given state and result if it hasn't been settled yet.
+func (task *AsyncTask[T]) finish(state TaskState, result WaitResult[T]) {
 	task.mu.Lock()
 
 	if task.result != nil {
+		task.mu.Unlock()
 		return
 	}
 
-	task.result = &WaitResult[T]{Value: value}
+	task.init()
+	task.result = &result
+	task.state = state
+	close(task.done)
+	cancel, cause := task.cancel, task.cause()
 	task.mu.Unlock()
 
-	for _, done := range task.queue {
-		done <- true
+	if cancel != nil {
+		cancel(cause)
 	}
 }
 
+// Resolve settles the task successfully with a given value.
+func (task *AsyncTask[T]) Resolve(value T) {
+	task.finish(TaskFulfilled, WaitResult[T]{Value: value})
+}
+
 // Reject settles the task with a failure reason.
 func (task *AsyncTask[T]) Reject(err error) {
-	task.mu.Lock()
+	task.finish(TaskRejected, WaitResult[T]{Error: err})
+}
 
-	if task.result != nil {
-		return
+// Cancel rejects the task with the given reason, or `context.Canceled` if the reason is nil, and
+// cancels the context returned by `AsyncTask.Context()`, so that the producer can stop the work.
+// It has no effect if the task has already been settled.
+func (task *AsyncTask[T]) Cancel(reason error) {
+	if reason == nil {
+		reason = context.Canceled
 	}
 
-	task.result = &WaitResult[T]{Error: err}
-	task.mu.Unlock()
+	task.finish(TaskCanceled, WaitResult[T]{Error: reason})
+}
+
+// Context returns the producer-side context of the task, which is canceled once the task is
+// settled. If the task is canceled, `context.Cause()` returns the reason passed to
+// `AsyncTask.Cancel()`.
+func (task *AsyncTask[T]) Context() context.Context {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+
+	if task.ctx == nil {
+		task.ctx, task.cancel = context.WithCancelCause(context.Background())
 
-	for _, done := range task.queue {
-		done <- true
+		if task.result != nil {
+			task.cancel(task.cause())
+		}
 	}
+
+	return task.ctx
+}
+
+// Done returns a channel that is closed once the task is settled.
+func (task *AsyncTask[T]) Done() <-chan struct{} {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+
+	task.init()
+	return task.done
+}
+
+// State returns the current state of the task without blocking.
+func (task *AsyncTask[T]) State() TaskState {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+
+	return task.state
 }
 
 // Result returns the result of the task.
 //
 // Successive calling this function returns the same result.
 func (task *AsyncTask[T]) Result() (T, error) {
-	task.mu.Lock()
+	<-task.Done()
+	return task.result.Value, task.result.Error
+}
 
-	if task.result != nil {
+// ResultContext is like `AsyncTask.Result()`, except it gives up waiting when the context is
+// canceled or its deadline exceeds, in which case the context's error is returned. The task itself
+// is not affected.
+func (task *AsyncTask[T]) ResultContext(ctx context.Context) (T, error) {
+	select {
+	case <-task.Done():
 		return task.result.Value, task.result.Error
+	case <-ctx.Done():
+		return *new(T), ctx.Err()
+	}
+}
+
+// settle resolves or rejects the task according to the error.
+func (task *AsyncTask[T]) settle(value T, err error) {
+	if err != nil {
+		task.Reject(err)
+	} else {
+		task.Resolve(value)
 	}
+}
 
-	done := make(chan bool)
-	task.queue = append(task.queue, done)
-	task.mu.Unlock()
+// Then returns a new task that is settled with the result of the `fn` function called with the
+// value of this task once it's resolved. If this task is rejected, the `fn` function is not
+// called, and the new task is rejected with the same error.
+func (task *AsyncTask[T]) Then(fn func(value T) (T, error)) *AsyncTask[T] {
+	return MapTask(task, fn)
+}
 
-	<-done
+// Catch returns a new task that is settled with the result of the `fn` function called with the
+// error of this task once it's rejected. If this task is resolved, the `fn` function is not
+// called, and the new task is resolved with the same value.
+func (task *AsyncTask[T]) Catch(fn func(err error) (T, error)) *AsyncTask[T] {
+	return Go(func() (T, error) {
+		value, err := task.Result()
 
-	return task.result.Value, task.result.Error
+		if err != nil {
+			return fn(err)
+		}
+
+		return value, nil
+	})
+}
+
+// Finally returns a new task that calls the `fn` function once this task is settled, and is then
+// settled with the same result as this task.
+func (task *AsyncTask[T]) Finally(fn func()) *AsyncTask[T] {
+	return Go(func() (T, error) {
+		value, err := task.Result()
+		fn()
+		return value, err
+	})
+}
+
+// Go runs the given function in another goroutine and returns a task that is settled with its
+// result.
+func Go[R any](fn func() (R, error)) *AsyncTask[R] {
+	task := &AsyncTask[R]{}
+
+	go func() {
+		task.settle(fn())
+	}()
+
+	return task
+}
+
+// GoContext is like `Go()`, except the function receives the producer-side context of the task,
+// which is canceled once the task is settled, including when it's canceled by
+// `AsyncTask.Cancel()` or when `ctx` is canceled, in which case the task is canceled with the
+// cause of `ctx`.
+func GoContext[R any](ctx context.Context, fn func(ctx context.Context) (R, error)) *AsyncTask[R] {
+	task := &AsyncTask[R]{}
+	taskCtx := task.Context()
+	stop := context.AfterFunc(ctx, func() {
+		task.Cancel(context.Cause(ctx))
+	})
+
+	go func() {
+		defer stop()
+		task.settle(fn(taskCtx))
+	}()
+
+	return task
+}
+
+// MapTask is like `AsyncTask.Then()`, except the `fn` function may transform the value into a
+// different type.
+func MapTask[T any, R any](task *AsyncTask[T], fn func(value T) (R, error)) *AsyncTask[R] {
+	return Go(func() (R, error) {
+		value, err := task.Result()
+
+		if err != nil {
+			return *new(R), err
+		}
+
+		return fn(value)
+	})
+}
+
+// resultFns converts the tasks into functions accepted by the `Wait` family functions.
+func resultFns[T any](tasks []*AsyncTask[T]) []func() (T, error) {
+	return slicex.Map(tasks, func(task *AsyncTask[T], _ int) func() (T, error) {
+		return task.Result
+	})
+}
+
+// AllTasks returns a task that is resolved with the values of all the tasks ordered accordingly
+// once all of them are resolved, or rejected once anyone of them is rejected, see `WaitAll()`.
+func AllTasks[T any](tasks ...*AsyncTask[T]) *AsyncTask[[]T] {
+	return Go(func() ([]T, error) {
+		return WaitAll(resultFns(tasks)...)
+	})
+}
+
+// AnyTask returns a task that is resolved with the value of the first resolved task, or rejected
+// with an `*AggregateError` of all the errors if all of them are rejected, see `WaitAnyAggregate()`.
+func AnyTask[T any](tasks ...*AsyncTask[T]) *AsyncTask[T] {
+	return Go(func() (T, error) {
+		return WaitAnyAggregate(resultFns(tasks)...)
+	})
+}
+
+// RaceTasks returns a task that is settled with the result of the first settled task, see
+// `WaitRace()`.
+func RaceTasks[T any](tasks ...*AsyncTask[T]) *AsyncTask[T] {
+	return Go(func() (T, error) {
+		return WaitRace(resultFns(tasks)...)
+	})
+}
+
+// AllSettledTasks returns a task that is resolved with the results of all the tasks ordered
+// accordingly once all of them are settled, see `WaitAllSettled()`.
+func AllSettledTasks[T any](tasks ...*AsyncTask[T]) *AsyncTask[[]WaitResult[T]] {
+	return Go(func() ([]WaitResult[T], error) {
+		return WaitAllSettled(resultFns(tasks)...), nil
+	})
 }
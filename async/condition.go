@@ -0,0 +1,69 @@
+package async
+
+import (
+	"context"
+	"sync"
+)
+
+// Condition lets goroutines wait for a state to change without polling, the goroutine that
+// changes the state calls `Broadcast()` to wake up the waiters, which then check the state again.
+//
+// Unlike `sync.Cond`, the waiting can be canceled by a context. The zero value is ready to use, a
+// Condition must not be copied after first use.
+type Condition struct {
+	mu      sync.Mutex
+	changed chan struct{} // closed and replaced on every broadcast
+}
+
+// channel returns the channel that is closed on the next broadcast.
+func (cond *Condition) channel() chan struct{} {
+	cond.mu.Lock()
+	defer cond.mu.Unlock()
+
+	if cond.changed == nil {
+		cond.changed = make(chan struct{})
+	}
+
+	return cond.changed
+}
+
+// Changed returns a channel that is closed on the next call of `Broadcast()`, which can be used in
+// a `select` statement.
+func (cond *Condition) Changed() <-chan struct{} {
+	return cond.channel()
+}
+
+// Broadcast wakes up all the goroutines waiting on the condition.
+func (cond *Condition) Broadcast() {
+	cond.mu.Lock()
+	defer cond.mu.Unlock()
+
+	if cond.changed != nil {
+		close(cond.changed)
+		cond.changed = nil
+	}
+}
+
+// Wait blocks until the test is passed, or the context is canceled or its deadline exceeds, in
+// which case the context's error is returned. The test is checked immediately and again after
+// every broadcast.
+//
+// The test should read the state under the same lock (if any) the broadcaster changes it with,
+// no change is missed as long as `Broadcast()` is called after the state is changed.
+func (cond *Condition) Wait(ctx context.Context, test func() bool) error {
+	for {
+		// take the channel before checking, so that a broadcast between the check and the
+		// waiting still wakes us up
+		changed := cond.channel()
+
+		if test() {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -1,11 +1,19 @@
 package async_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
 	"time"
 
 	"github.com/ayonli/goext/async"
+	"github.com/ayonli/goext/clock"
+	"github.com/ayonli/goext/slicex"
+	"github.com/stretchr/testify/assert"
 )
 
 func ExampleWait() {
@@ -108,6 +116,52 @@ func ExampleWaitAny_error() {
 	// [something went wrong something went wrong something went wrong]
 }
 
+func ExampleWaitAnyAggregate() {
+	errTimeout := errors.New("timeout")
+	_, err := async.WaitAnyAggregate(func() (string, error) {
+		return "", errors.New("something went wrong")
+	}, func() (string, error) {
+		return "", fmt.Errorf("request failed: %w", errTimeout)
+	})
+
+	var aggErr *async.AggregateError
+
+	fmt.Println(err)
+	fmt.Println(errors.Is(err, errTimeout))
+	fmt.Println(errors.As(err, &aggErr), len(aggErr.Errors))
+	// Output:
+	// 2 errors occurred:
+	//   [0] something went wrong
+	//   [1] request failed: timeout
+	// true
+	// true 2
+}
+
+func ExampleWaitAnyAggregate_empty() {
+	_, err := async.WaitAnyAggregate[func() (string, error)]()
+	_, taskErr := async.AnyTask[string]().Result()
+
+	fmt.Println(err)
+	fmt.Println(taskErr)
+	// Output:
+	// no function succeeded
+	// no function succeeded
+}
+
+func ExampleAggregateError() {
+	err := &async.AggregateError{Errors: []error{
+		errors.New("something went wrong"),
+		errors.New("multiple\nlines"),
+	}}
+
+	fmt.Println(err)
+	// Output:
+	// 2 errors occurred:
+	//   [0] something went wrong
+	//   [1] multiple
+	//     lines
+}
+
 func ExampleWaitAll() {
 	results, err := async.WaitAll(func() (string, error) {
 		time.Sleep(time.Microsecond * 1)
@@ -171,6 +225,166 @@ func ExampleWaitAllSettled() {
 	// something went wrong
 }
 
+func ExampleWaitAllLimit() {
+	running := int32(0)
+	peak := int32(0)
+	fns := []func() (int, error){}
+
+	for i := 0; i < 10; i++ {
+		i := i
+		fns = append(fns, func() (int, error) {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+
+			for {
+				if p := atomic.LoadInt32(&peak); n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+
+			time.Sleep(time.Millisecond)
+			return i * i, nil
+		})
+	}
+
+	results, err := async.WaitAllLimit(3, fns...)
+
+	fmt.Println(results)
+	fmt.Println(err)
+	fmt.Println(atomic.LoadInt32(&peak) <= 3)
+	// Output:
+	// [0 1 4 9 16 25 36 49 64 81]
+	// <nil>
+	// true
+}
+
+func ExampleWaitAllLimit_error() {
+	started := int32(0)
+	fns := []func() (int, error){}
+
+	for i := 0; i < 10; i++ {
+		i := i
+		fns = append(fns, func() (int, error) {
+			atomic.AddInt32(&started, 1)
+
+			if i == 1 {
+				return 0, errors.New("something went wrong")
+			}
+
+			return i, nil
+		})
+	}
+
+	results, err := async.WaitAllLimit(1, fns...)
+
+	fmt.Printf("%#v\n", results)
+	fmt.Println(err)
+	fmt.Println(atomic.LoadInt32(&started)) // the rest are skipped
+	// Output:
+	// []int(nil)
+	// something went wrong
+	// 2
+}
+
+func ExampleWaitAllSettledLimit() {
+	results := async.WaitAllSettledLimit(2, func() (string, error) {
+		return "Hello, World!", nil
+	}, func() (string, error) {
+		return "", errors.New("something went wrong")
+	}, func() (string, error) {
+		return "Hi, World!", nil
+	})
+
+	for _, result := range results {
+		if result.Error != nil {
+			fmt.Println(result.Error)
+		} else {
+			fmt.Println(result.Value)
+		}
+	}
+	// Output:
+	// Hello, World!
+	// something went wrong
+	// Hi, World!
+}
+
+func ExampleParallelMap() {
+	ids := []int{1, 2, 3, 4, 5}
+	names, err := async.ParallelMap(ids, 2, func(id int, _ int) (string, error) {
+		time.Sleep(time.Millisecond * time.Duration(5-id)) // finishes in reverse order
+		return fmt.Sprintf("user-%d", id), nil
+	})
+
+	fmt.Println(names)
+	fmt.Println(err)
+	// Output:
+	// [user-1 user-2 user-3 user-4 user-5]
+	// <nil>
+}
+
+func ExampleWaitRaceContext() {
+	stopped := make(chan error, 1)
+	res, err := async.WaitRaceContext(context.Background(), func(ctx context.Context) (string, error) {
+		return "Hello, World!", nil
+	}, func(ctx context.Context) (string, error) {
+		<-ctx.Done() // canceled once the race is settled
+		stopped <- ctx.Err()
+		return "", ctx.Err()
+	})
+
+	fmt.Println(res)
+	fmt.Println(err)
+	fmt.Println(<-stopped)
+	// Output:
+	// Hello, World!
+	// <nil>
+	// context canceled
+}
+
+func ExampleWaitAnyContext() {
+	stopped := make(chan error, 1)
+	res, errs := async.WaitAnyContext(context.Background(), func(ctx context.Context) (string, error) {
+		return "", errors.New("something went wrong")
+	}, func(ctx context.Context) (string, error) {
+		return "Hello, World!", nil
+	}, func(ctx context.Context) (string, error) {
+		<-ctx.Done() // canceled once any function succeeds
+		stopped <- ctx.Err()
+		return "", ctx.Err()
+	})
+
+	fmt.Println(res)
+	fmt.Println(errs)
+	fmt.Println(<-stopped)
+	// Output:
+	// Hello, World!
+	// []
+	// context canceled
+}
+
+func ExampleWaitAllContext() {
+	stopped := make(chan error, 1)
+	results, err := async.WaitAllContext(context.Background(), func(ctx context.Context) (string, error) {
+		return "", errors.New("something went wrong")
+	}, func(ctx context.Context) (string, error) {
+		select {
+		case <-time.After(time.Second):
+			return "Hello, World!", nil
+		case <-ctx.Done(): // canceled once any function fails
+			stopped <- ctx.Err()
+			return "", ctx.Err()
+		}
+	})
+
+	fmt.Println(results)
+	fmt.Println(err)
+	fmt.Println(<-stopped)
+	// Output:
+	// []
+	// something went wrong
+	// context canceled
+}
+
 func ExampleWaitTimeout() {
 	res1, err1 := async.WaitTimeout(func() (string, error) {
 		return "Hello, World!", nil
@@ -217,6 +431,69 @@ func ExampleWaitUntil() {
 	// 10
 }
 
+func ExampleWaitUntilContext() {
+	err := async.WaitUntilContext(context.Background(), func() bool {
+		return false
+	}, async.WaitUntilOptions{
+		Timeout:  time.Millisecond * 20,
+		Interval: time.Millisecond * 5,
+	})
+	fmt.Println(err)
+	// Output:
+	// context deadline exceeded
+}
+
+func ExampleWaitUntilContext_backoff() {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	checks := []time.Time{}
+	done := make(chan struct{})
+
+	go func() {
+		async.WaitUntilContext(context.Background(), func() bool {
+			checks = append(checks, fake.Now())
+			return len(checks) == 5
+		}, async.WaitUntilOptions{
+			Backoff:     async.ExponentialBackoff(time.Second, 2),
+			MaxInterval: 5 * time.Second,
+		}, async.WithClock(fake))
+		close(done)
+	}()
+
+	for _, delay := range []time.Duration{1, 2, 4, 5} {
+		fake.BlockUntil(1) // wait for the polling timer to be set
+		fake.Advance(delay * time.Second)
+	}
+
+	<-done
+	fmt.Println(slicex.Map(checks, func(t time.Time, _ int) string {
+		return t.Format(time.TimeOnly)
+	}))
+	// Output:
+	// [00:00:00 00:00:01 00:00:03 00:00:07 00:00:12]
+}
+
+func ExampleWithClock() {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	release := make(chan struct{})
+	defer close(release)
+	done := make(chan struct{})
+
+	go func() {
+		_, err := async.WaitTimeout(func() (string, error) {
+			<-release
+			return "Hello, World!", nil
+		}, time.Hour, async.WithClock(fake))
+		fmt.Println(err)
+		close(done)
+	}()
+
+	fake.BlockUntil(1) // wait for the timer to be set
+	fake.Advance(time.Hour)
+	<-done
+	// Output:
+	// context deadline exceeded
+}
+
 func ExampleQueue() {
 	out := make(chan []string)
 	list := []string{}
@@ -319,3 +596,427 @@ func ExampleAsyncTask_Result() {
 	// Hello, World!
 	// Hello, World!
 }
+
+func ExampleGo() {
+	task := async.Go(func() (string, error) {
+		// this function runs in another goroutine
+		return "Hello, World!", nil
+	})
+
+	res, err := task.Result()
+
+	fmt.Println(res)
+	fmt.Println(err)
+	// Output:
+	// Hello, World!
+	// <nil>
+}
+
+func ExampleAsyncTask_Then() {
+	task := async.Go(func() (int, error) {
+		return 1, nil
+	}).Then(func(value int) (int, error) {
+		return value * 10, nil
+	}).Then(func(value int) (int, error) {
+		return value + 1, nil
+	})
+
+	fmt.Println(task.Result())
+	// Output:
+	// 11 <nil>
+}
+
+func ExampleAsyncTask_Catch() {
+	task := async.Go(func() (int, error) {
+		return 0, errors.New("something went wrong")
+	}).Then(func(value int) (int, error) {
+		return value * 10, nil // skipped since the task is rejected
+	}).Catch(func(err error) (int, error) {
+		fmt.Println("recovered from:", err)
+		return -1, nil
+	})
+
+	fmt.Println(task.Result())
+	// Output:
+	// recovered from: something went wrong
+	// -1 <nil>
+}
+
+func ExampleAsyncTask_Finally() {
+	task := async.Go(func() (string, error) {
+		return "", errors.New("something went wrong")
+	}).Finally(func() {
+		fmt.Println("cleaning up")
+	})
+
+	_, err := task.Result()
+
+	fmt.Println(err)
+	// Output:
+	// cleaning up
+	// something went wrong
+}
+
+func ExampleMapTask() {
+	task := async.MapTask(async.Go(func() (int, error) {
+		return 42, nil
+	}), func(value int) (string, error) {
+		return fmt.Sprintf("the answer is %d", value), nil
+	})
+
+	fmt.Println(task.Result())
+	// Output:
+	// the answer is 42 <nil>
+}
+
+func ExampleAllTasks() {
+	task := async.AllTasks(async.Go(func() (string, error) {
+		time.Sleep(time.Millisecond * 2)
+		return "Hello, World!", nil
+	}), async.Go(func() (string, error) {
+		return "Hi, World!", nil
+	}))
+
+	fmt.Println(task.Result())
+	// Output:
+	// [Hello, World! Hi, World!] <nil>
+}
+
+func ExampleAnyTask() {
+	task := async.AnyTask(async.Go(func() (string, error) {
+		return "", errors.New("something went wrong")
+	}), async.Go(func() (string, error) {
+		time.Sleep(time.Millisecond * 2)
+		return "Hello, World!", nil
+	}))
+
+	fmt.Println(task.Result())
+	// Output:
+	// Hello, World! <nil>
+}
+
+func ExampleRaceTasks() {
+	task := async.RaceTasks(async.Go(func() (string, error) {
+		time.Sleep(time.Millisecond * 20)
+		return "Hello, World!", nil
+	}), async.Go(func() (string, error) {
+		return "", errors.New("something went wrong")
+	}))
+
+	_, err := task.Result()
+
+	fmt.Println(err)
+	// Output:
+	// something went wrong
+}
+
+func ExampleAllSettledTasks() {
+	task := async.AllSettledTasks(async.Go(func() (string, error) {
+		return "Hello, World!", nil
+	}), async.Go(func() (string, error) {
+		return "", errors.New("something went wrong")
+	}))
+
+	results, _ := task.Result()
+
+	for _, result := range results {
+		if result.Error != nil {
+			fmt.Println(result.Error)
+		} else {
+			fmt.Println(result.Value)
+		}
+	}
+	// Output:
+	// Hello, World!
+	// something went wrong
+}
+
+func ExampleAsyncTask_State() {
+	task := &async.AsyncTask[string]{}
+	fmt.Println(task.State())
+
+	task.Resolve("Hello, World!")
+	task.Reject(errors.New("something went wrong")) // no effect once settled
+	fmt.Println(task.State())
+	// Output:
+	// pending
+	// fulfilled
+}
+
+func ExampleAsyncTask_Done() {
+	task := async.Go(func() (string, error) {
+		time.Sleep(time.Millisecond)
+		return "Hello, World!", nil
+	})
+
+	select {
+	case <-task.Done():
+		fmt.Println(task.Result())
+	case <-time.After(time.Second):
+		fmt.Println("timeout")
+	}
+	// Output:
+	// Hello, World! <nil>
+}
+
+func ExampleAsyncTask_ResultContext() {
+	task := &async.AsyncTask[string]{} // never settled
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*5)
+	defer cancel()
+
+	res, err := task.ResultContext(ctx)
+
+	fmt.Printf("%#v\n", res)
+	fmt.Println(err)
+	fmt.Println(task.State())
+	// Output:
+	// ""
+	// context deadline exceeded
+	// pending
+}
+
+func ExampleAsyncTask_Cancel() {
+	stopped := make(chan error)
+	task := async.GoContext(context.Background(), func(ctx context.Context) (string, error) {
+		<-ctx.Done() // notified once the task is canceled
+		stopped <- context.Cause(ctx)
+		return "", ctx.Err()
+	})
+
+	task.Cancel(errors.New("no longer needed"))
+	_, err := task.Result()
+
+	fmt.Println(<-stopped)
+	fmt.Println(err)
+	fmt.Println(task.State())
+	// Output:
+	// no longer needed
+	// no longer needed
+	// canceled
+}
+
+func ExampleGoContext() {
+	ctx, cancel := context.WithCancel(context.Background())
+	task := async.GoContext(ctx, func(ctx context.Context) (string, error) {
+		select {
+		case <-time.After(time.Second):
+			return "Hello, World!", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	})
+
+	cancel() // canceling the parent context cancels the task
+	_, err := task.Result()
+
+	fmt.Println(err)
+	fmt.Println(task.State())
+	// Output:
+	// context canceled
+	// canceled
+}
+
+func ExampleRetry() {
+	attempts := 0
+	res, err := async.Retry(context.Background(), func(ctx context.Context) (string, error) {
+		attempts++
+
+		if attempts < 3 {
+			return "", errors.New("something went wrong")
+		}
+
+		return "Hello, World!", nil
+	}, async.RetryPolicy{
+		Backoff:     async.ConstantBackoff(time.Millisecond),
+		MaxAttempts: 5,
+		OnRetry: func(attempts int, err error, delay time.Duration) {
+			fmt.Println(attempts, err, delay)
+		},
+	})
+
+	fmt.Println(res, err)
+	// Output:
+	// 1 something went wrong 1ms
+	// 2 something went wrong 1ms
+	// Hello, World! <nil>
+}
+
+func ExampleRetry_permanent() {
+	attempts := 0
+	_, err := async.Retry(context.Background(), func(ctx context.Context) (string, error) {
+		attempts++
+		return "", async.Permanent(errors.New("bad request"))
+	}, async.RetryPolicy{MaxAttempts: 5})
+
+	fmt.Println(attempts, err)
+	// Output:
+	// 1 bad request
+}
+
+func ExampleRetry_clock() {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	done := make(chan struct{})
+
+	go func() {
+		_, err := async.Retry(context.Background(), func(ctx context.Context) (string, error) {
+			return "", errors.New("something went wrong")
+		}, async.RetryPolicy{
+			Backoff:    async.ExponentialBackoff(time.Second, 2),
+			MaxDelay:   5 * time.Second,
+			MaxElapsed: 15 * time.Second,
+			OnRetry: func(attempts int, err error, delay time.Duration) {
+				fmt.Println(attempts, delay)
+			},
+		}, async.WithClock(fake))
+		fmt.Println(err)
+		close(done)
+	}()
+
+	for _, delay := range []time.Duration{1, 2, 4, 5} {
+		fake.BlockUntil(1) // wait for the backoff timer to be set
+		fake.Advance(delay * time.Second)
+	}
+
+	<-done
+	// Output:
+	// 1 1s
+	// 2 2s
+	// 3 4s
+	// 4 5s
+	// something went wrong
+}
+
+func ExampleBackoff() {
+	backoffs := []async.Backoff{
+		async.ConstantBackoff(time.Second),
+		async.LinearBackoff(time.Second),
+		async.ExponentialBackoff(time.Second, 3),
+	}
+
+	for _, backoff := range backoffs {
+		delays := []time.Duration{}
+		delay := time.Duration(0)
+
+		for attempts := 1; attempts <= 4; attempts++ {
+			delay = backoff(attempts, delay)
+			delays = append(delays, delay)
+		}
+
+		fmt.Println(delays)
+	}
+
+	jitter := async.DecorrelatedJitterBackoff(time.Second)
+	delay := jitter(2, 2*time.Second)
+	fmt.Println(delay >= time.Second && delay <= 6*time.Second)
+	// Output:
+	// [1s 1s 1s 1s]
+	// [1s 2s 3s 4s]
+	// [1s 3s 9s 27s]
+	// true
+}
+
+func ExampleCondition() {
+	var cond async.Condition
+	var mu sync.Mutex
+	ready := false
+	done := make(chan struct{})
+
+	go func() {
+		err := cond.Wait(context.Background(), func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return ready
+		})
+		fmt.Println("ready:", err)
+		close(done)
+	}()
+
+	time.Sleep(time.Millisecond * 5)
+	mu.Lock()
+	ready = true
+	mu.Unlock()
+	cond.Broadcast()
+
+	<-done
+	// Output:
+	// ready: <nil>
+}
+
+func ExampleCondition_Wait() {
+	var cond async.Condition
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*5)
+	defer cancel()
+
+	err := cond.Wait(ctx, func() bool { return false })
+	fmt.Println(err)
+	// Output:
+	// context deadline exceeded
+}
+
+func TestRetry(suit *testing.T) {
+	suit.Run("overflow", func(t *testing.T) {
+		maxDuration := time.Duration(math.MaxInt64)
+
+		exponential := async.ExponentialBackoff(100*time.Millisecond, 2)
+		assert.Equal(t, maxDuration, exponential(38, 0))
+		assert.Equal(t, maxDuration, exponential(1000, 0))
+
+		linear := async.LinearBackoff(maxDuration / 2)
+		assert.Equal(t, maxDuration, linear(3, 0))
+
+		jitter := async.DecorrelatedJitterBackoff(time.Second)
+		delay := jitter(100, maxDuration)
+		assert.GreaterOrEqual(t, delay, time.Second)
+		assert.LessOrEqual(t, delay, maxDuration)
+	})
+
+	suit.Run("MaxDelay", func(t *testing.T) {
+		fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		delays := []time.Duration{}
+		done := make(chan error)
+
+		go func() {
+			_, err := async.Retry(context.Background(), func(ctx context.Context) (int, error) {
+				return 0, errors.New("something went wrong")
+			}, async.RetryPolicy{
+				Backoff:     async.ExponentialBackoff(100*time.Millisecond, 2),
+				MaxDelay:    30 * time.Second,
+				MaxAttempts: 50,
+				OnRetry: func(attempts int, err error, delay time.Duration) {
+					delays = append(delays, delay)
+				},
+			}, async.WithClock(fake))
+			done <- err
+		}()
+
+		for i := 0; i < 49; i++ {
+			fake.BlockUntil(1)
+			fake.Advance(30 * time.Second)
+		}
+
+		assert.EqualError(t, <-done, "something went wrong")
+		assert.Equal(t, 49, len(delays))
+
+		// the overflowing backoffs from the 38th attempt on are capped as well
+		for _, delay := range delays[9:] {
+			assert.Equal(t, 30*time.Second, delay)
+		}
+	})
+
+	suit.Run("MaxElapsed", func(t *testing.T) {
+		attempts := 0
+		_, err := async.Retry(context.Background(), func(ctx context.Context) (int, error) {
+			attempts++
+			return 0, errors.New("something went wrong")
+		}, async.RetryPolicy{
+			Backoff: func(attempts int, prev time.Duration) time.Duration {
+				return -time.Second // a negative delay must not retry at once
+			},
+			MaxElapsed: time.Hour,
+		})
+
+		assert.EqualError(t, err, "something went wrong")
+		assert.Equal(t, 1, attempts)
+	})
+}
@@ -0,0 +1,193 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff returns the duration to wait before the next attempt, given the number of attempts that
+// have failed so far (starting from 1) and the previous duration (0 before the first retry).
+type Backoff func(attempts int, prev time.Duration) time.Duration
+
+// durationOf converts the nanoseconds to a duration, clamping them to the range of durations so
+// that large backoffs don't overflow into negative ones.
+func durationOf(ns float64) time.Duration {
+	if ns >= math.MaxInt64 {
+		return math.MaxInt64
+	} else if ns <= 0 {
+		return 0
+	}
+
+	return time.Duration(ns)
+}
+
+// ConstantBackoff waits the same duration before every retry.
+func ConstantBackoff(delay time.Duration) Backoff {
+	return func(attempts int, prev time.Duration) time.Duration {
+		return delay
+	}
+}
+
+// LinearBackoff waits `delay` before the first retry, and `delay` longer before each of the
+// following ones.
+func LinearBackoff(delay time.Duration) Backoff {
+	return func(attempts int, prev time.Duration) time.Duration {
+		return durationOf(float64(delay) * float64(attempts))
+	}
+}
+
+// ExponentialBackoff waits `delay` before the first retry, and multiplies the duration by
+// `multiplier` before each of the following ones. If `multiplier` is not greater than 1, 2 is used.
+func ExponentialBackoff(delay time.Duration, multiplier float64) Backoff {
+	if multiplier <= 1 {
+		multiplier = 2
+	}
+
+	return func(attempts int, prev time.Duration) time.Duration {
+		return durationOf(float64(delay) * math.Pow(multiplier, float64(attempts-1)))
+	}
+}
+
+// DecorrelatedJitterBackoff waits `delay` before the first retry, and a random duration between
+// `delay` and three times the previous one before each of the following ones, which spreads the
+// retries of different callers better than a fixed jitter.
+func DecorrelatedJitterBackoff(delay time.Duration) Backoff {
+	return func(attempts int, prev time.Duration) time.Duration {
+		if prev < delay {
+			return delay
+		}
+
+		upper := durationOf(float64(prev) * 3)
+		return delay + durationOf(rand.Float64()*float64(upper-delay))
+	}
+}
+
+// RetryPolicy configures how `async.Retry()` retries the function.
+//
+// Unlike `goext.RetryPolicy`, which is used to opt in to the retries of a queue and performs no
+// retry by default, the zero value of this policy makes up to 3 attempts. Both policies compute
+// their backoffs with `async.Backoff`.
+type RetryPolicy struct {
+	// Backoff computes the duration to wait before each retry, default
+	// `ExponentialBackoff(100*time.Millisecond, 2)`.
+	Backoff Backoff
+	// MaxDelay caps the duration returned by Backoff, if not set, the duration is not capped.
+	MaxDelay time.Duration
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	MaxAttempts int
+	// MaxElapsed is the maximum time spent since the first attempt starts, no retry is made if it
+	// would start after that.
+	//
+	// If neither MaxAttempts nor MaxElapsed is set, at most 3 attempts are made.
+	MaxElapsed time.Duration
+	// Retryable reports whether the error should be retried, if not set, all errors are retryable
+	// except the ones marked by `async.Permanent()`.
+	Retryable func(err error) bool
+	// OnRetry is called before waiting for each retry, with the number of attempts that have failed
+	// so far, the error of the last attempt and the duration to wait.
+	OnRetry func(attempts int, err error, delay time.Duration)
+}
+
+// PermanentError marks an error that should not be retried, see `async.Permanent()`.
+type PermanentError struct {
+	Err error
+}
+
+func (err *PermanentError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *PermanentError) Unwrap() error {
+	return err.Err
+}
+
+// Permanent wraps the error so that `async.Retry()` stops retrying and returns the error at once,
+// regardless of the policy. It returns nil if the error is nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &PermanentError{Err: err}
+}
+
+// Retry calls the function until it succeeds, or the policy decides to give up, in which case the
+// error of the last attempt is returned. If the function returns an error marked by
+// `async.Permanent()`, the retrying stops and the wrapped error is returned.
+//
+// The function receives `ctx`, and if the context is canceled or its deadline exceeds while waiting
+// for the next attempt, the context's error is returned.
+//
+// The waiting between attempts honors the clock set by `async.WithClock()`.
+func Retry[R any](
+	ctx context.Context,
+	fn func(ctx context.Context) (R, error),
+	policy RetryPolicy,
+	opts ...Option,
+) (R, error) {
+	clk := resolveOptions(opts).clock
+	backoff := policy.Backoff
+	maxAttempts := policy.MaxAttempts
+
+	if backoff == nil {
+		backoff = ExponentialBackoff(100*time.Millisecond, 2)
+	}
+
+	if maxAttempts <= 0 && policy.MaxElapsed <= 0 {
+		maxAttempts = 3
+	}
+
+	start := clk.Now()
+	delay := time.Duration(0)
+
+	for attempts := 1; ; attempts++ {
+		if err := ctx.Err(); err != nil {
+			return *new(R), err
+		}
+
+		value, err := fn(ctx)
+
+		if err == nil {
+			return value, nil
+		}
+
+		var permanent *PermanentError
+
+		if errors.As(err, &permanent) {
+			return value, permanent.Err
+		} else if maxAttempts > 0 && attempts >= maxAttempts {
+			return value, err
+		} else if policy.Retryable != nil && !policy.Retryable(err) {
+			return value, err
+		}
+
+		delay = backoff(attempts, delay)
+
+		// a negative delay can only come from an overflow, so it's treated as capped as well
+		if policy.MaxDelay > 0 && (delay > policy.MaxDelay || delay < 0) {
+			delay = policy.MaxDelay
+		} else if delay < 0 {
+			delay = math.MaxInt64
+		}
+
+		if policy.MaxElapsed > 0 && delay > policy.MaxElapsed-clk.Since(start) {
+			return value, err
+		}
+
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempts, err, delay)
+		}
+
+		timer := clk.NewTimer(delay)
+
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return *new(R), ctx.Err()
+		}
+	}
+}
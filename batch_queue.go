@@ -0,0 +1,73 @@
+package goext
+
+import (
+	"time"
+)
+
+// BatchQueueOptions configures the queue created by `goext.BatchQueue()`.
+type BatchQueueOptions struct {
+	QueueOptions
+	// MaxSize is the maximum number of data in a batch, once reached, the batch is flushed
+	// immediately. If not set, batches are only flushed by time or when the queue is closed.
+	MaxSize int
+	// MaxWait is the maximum duration to wait since the first data of a batch arrives, once
+	// passed, the batch is flushed even if it's not full. If not set, batches are only flushed by
+	// size or when the queue is closed.
+	MaxWait time.Duration
+}
+
+// BatchQueue is like `goext.QueueWithOptions()`, except the `handler` function receives data in
+// batches. A batch is flushed when it reaches `options.MaxSize` or when `options.MaxWait` has
+// passed since its first data arrives, whichever comes first, and the partial batch is flushed
+// when the queue is closed.
+//
+// If the `handler` function panics, the whole batch is retried according to `options.Retry`, if
+// it still fails, the error handler is called once, and all the data in the batch are counted as
+// failed and sent to the dead-letter handler respectively.
+func BatchQueue[T any](handler func(batch []T), options BatchQueueOptions) IQueue[T] {
+	queue := newQueue[T](options.QueueOptions)
+	queue.start(options.Concurrency, func() {
+		var batch []T
+		var timer *time.Timer
+		var timeout <-chan time.Time
+
+		flush := func() {
+			if timer != nil {
+				timer.Stop()
+				timer = nil
+				timeout = nil
+			}
+
+			if len(batch) > 0 {
+				items := batch
+				batch = nil
+				queue.handle(items, func() {
+					handler(items)
+				})
+			}
+		}
+
+		for {
+			select {
+			case data, ok := <-queue.channel:
+				if !ok {
+					flush()
+					return
+				}
+
+				batch = append(batch, data)
+
+				if options.MaxSize > 0 && len(batch) >= options.MaxSize {
+					flush()
+				} else if len(batch) == 1 && options.MaxWait > 0 {
+					timer = time.NewTimer(options.MaxWait)
+					timeout = timer.C
+				}
+			case <-timeout:
+				flush()
+			}
+		}
+	})
+
+	return queue
+}
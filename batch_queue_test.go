@@ -0,0 +1,103 @@
+package goext_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ayonli/goext"
+	"github.com/stretchr/testify/assert"
+)
+
+func ExampleBatchQueue() {
+	queue := goext.BatchQueue(func(batch []int) {
+		fmt.Println(batch)
+	}, goext.BatchQueueOptions{
+		QueueOptions: goext.QueueOptions{BufferSize: 10},
+		MaxSize:      3,
+	})
+
+	for i := 1; i <= 7; i++ {
+		queue.Push(i)
+	}
+
+	// the partial batch is flushed when the queue is closed
+	queue.Drain(context.Background())
+	// Output:
+	// [1 2 3]
+	// [4 5 6]
+	// [7]
+}
+
+func TestBatchQueue(t *testing.T) {
+	t.Run("MaxWait", func(t *testing.T) {
+		out := make(chan []int)
+		queue := goext.BatchQueue(func(batch []int) {
+			out <- batch
+		}, goext.BatchQueueOptions{
+			MaxSize: 10,
+			MaxWait: time.Millisecond * 5,
+		})
+		defer queue.Close()
+
+		start := time.Now()
+		queue.Push(1)
+		queue.Push(2)
+
+		assert.Equal(t, []int{1, 2}, <-out)
+		assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*5)
+
+		queue.Push(3)
+		assert.Equal(t, []int{3}, <-out)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		errs := []error{}
+		queue := goext.BatchQueue(func(batch []int) {
+			if batch[0] == 1 {
+				panic(errors.New("something went wrong"))
+			}
+		}, goext.BatchQueueOptions{
+			QueueOptions: goext.QueueOptions{BufferSize: 10},
+			MaxSize:      2,
+		})
+		queue.OnError(func(err error) {
+			errs = append(errs, err)
+		})
+
+		for i := 1; i <= 5; i++ {
+			queue.Push(i)
+		}
+
+		queue.Drain(context.Background())
+		assert.Equal(t, 1, len(errs))
+		assert.Equal(t, "something went wrong", errs[0].Error())
+		assert.Equal(t, goext.QueueStats{Processed: 3, Failed: 2}, queue.Stats())
+	})
+
+	t.Run("concurrency", func(t *testing.T) {
+		total := make(chan int, 10)
+		queue := goext.BatchQueue(func(batch []int) {
+			total <- len(batch)
+		}, goext.BatchQueueOptions{
+			QueueOptions: goext.QueueOptions{BufferSize: 10, Concurrency: 3},
+			MaxSize:      4,
+		})
+
+		for i := 0; i < 20; i++ {
+			queue.Push(i)
+		}
+
+		queue.Drain(context.Background())
+		close(total)
+
+		sum := 0
+		for n := range total {
+			sum += n
+		}
+
+		assert.Equal(t, 20, sum)
+	})
+}
@@ -0,0 +1,280 @@
+// Additional functions for working with channels, all goroutines spawned by these functions exit
+// once the given context is canceled, so that nothing leaks.
+package chanx
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Reads all values from the channel until it's closed, or the context is canceled, in which case
+// the values read so far and the context's error are returned.
+func ReadAllContext[T any](ctx context.Context, ch <-chan T) ([]T, error) {
+	values := []T{}
+
+	for {
+		select {
+		case val, ok := <-ch:
+			if !ok {
+				return values, nil
+			}
+
+			values = append(values, val)
+		case <-ctx.Done():
+			return values, ctx.Err()
+		}
+	}
+}
+
+// Reads at most `n` values from the channel, it returns fewer values if the channel is closed
+// before that, or the context is canceled, in which case the context's error is returned as well.
+func ReadN[T any](ctx context.Context, ch <-chan T, n int) ([]T, error) {
+	values := make([]T, 0, max(n, 0))
+
+	for len(values) < n {
+		select {
+		case val, ok := <-ch:
+			if !ok {
+				return values, nil
+			}
+
+			values = append(values, val)
+		case <-ctx.Done():
+			return values, ctx.Err()
+		}
+	}
+
+	return values, nil
+}
+
+// Returns a channel that relays the values from the given channel, and is closed once the given
+// channel is closed or the context is canceled. This is useful to range over a channel without
+// blocking forever.
+func OrDone[T any](ctx context.Context, ch <-chan T) <-chan T {
+	out := make(chan T)
+
+	go func() {
+		defer close(out)
+
+		for {
+			select {
+			case val, ok := <-ch:
+				if !ok {
+					return
+				}
+
+				select {
+				case out <- val:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// Merges (fans in) multiple channels into one, the returned channel is closed once all the given
+// channels are closed or the context is canceled.
+func Merge[T any](ctx context.Context, channels ...<-chan T) <-chan T {
+	out := make(chan T)
+	wg := sync.WaitGroup{}
+	wg.Add(len(channels))
+
+	for _, ch := range channels {
+		go func(ch <-chan T) {
+			defer wg.Done()
+
+			for val := range OrDone(ctx, ch) {
+				select {
+				case out <- val:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(ch)
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// Distributes (fans out) the values from the given channel to `n` channels, each value is sent to
+// only one of them, whichever is ready first. The returned channels are closed once the given
+// channel is closed or the context is canceled.
+func FanOut[T any](ctx context.Context, ch <-chan T, n int) []<-chan T {
+	outs := make([]<-chan T, n)
+
+	for i := range outs {
+		out := make(chan T)
+		outs[i] = out
+
+		go func() {
+			defer close(out)
+
+			for val := range OrDone(ctx, ch) {
+				select {
+				case out <- val:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	return outs
+}
+
+// Duplicates the values from the given channel to two channels, each value is sent to both of
+// them before the next value is read, so a slow reader blocks the other. The returned channels are
+// closed once the given channel is closed or the context is canceled.
+func Tee[T any](ctx context.Context, ch <-chan T) (<-chan T, <-chan T) {
+	out1 := make(chan T)
+	out2 := make(chan T)
+
+	go func() {
+		defer close(out1)
+		defer close(out2)
+
+		for val := range OrDone(ctx, ch) {
+			out1, out2 := out1, out2 // shadowed, so that they can be disabled once sent
+
+			for i := 0; i < 2; i++ {
+				select {
+				case out1 <- val:
+					out1 = nil
+				case out2 <- val:
+					out2 = nil
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out1, out2
+}
+
+// Returns a channel of the values from the given channel transformed by the `fn` function. The
+// returned channel is closed once the given channel is closed or the context is canceled.
+func Map[T any, U any](ctx context.Context, ch <-chan T, fn func(value T) U) <-chan U {
+	out := make(chan U)
+
+	go func() {
+		defer close(out)
+
+		for val := range OrDone(ctx, ch) {
+			select {
+			case out <- fn(val):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// Returns a channel of the values from the given channel that satisfy the `fn` function. The
+// returned channel is closed once the given channel is closed or the context is canceled.
+func Filter[T any](ctx context.Context, ch <-chan T, fn func(value T) bool) <-chan T {
+	out := make(chan T)
+
+	go func() {
+		defer close(out)
+
+		for val := range OrDone(ctx, ch) {
+			if !fn(val) {
+				continue
+			}
+
+			select {
+			case out <- val:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// Groups the values from the given channel into batches, a batch is sent when it reaches `size`,
+// or when `wait` has passed since its first value arrives, whichever comes first. A zero `size`
+// means no size limit, and a zero `wait` means no time limit. The partial batch is sent when the
+// given channel is closed, and the returned channel is closed after that, or once the context is
+// canceled.
+func Batch[T any](ctx context.Context, ch <-chan T, size int, wait time.Duration) <-chan []T {
+	out := make(chan []T)
+
+	go func() {
+		defer close(out)
+
+		var batch []T
+		var timer *time.Timer
+		var timeout <-chan time.Time
+
+		flush := func() bool {
+			if timer != nil {
+				timer.Stop()
+				timer = nil
+				timeout = nil
+			}
+
+			if len(batch) == 0 {
+				return true
+			}
+
+			select {
+			case out <- batch:
+				batch = nil
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+
+		for {
+			select {
+			case val, ok := <-ch:
+				if !ok {
+					flush()
+					return
+				}
+
+				batch = append(batch, val)
+
+				if size > 0 && len(batch) >= size {
+					if !flush() {
+						return
+					}
+				} else if len(batch) == 1 && wait > 0 {
+					timer = time.NewTimer(wait)
+					timeout = timer.C
+				}
+			case <-timeout:
+				if !flush() {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
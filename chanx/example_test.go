@@ -0,0 +1,206 @@
+package chanx_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ayonli/goext/chanx"
+)
+
+func generate(ctx context.Context, values ...int) <-chan int {
+	ch := make(chan int)
+
+	go func() {
+		defer close(ch)
+
+		for _, val := range values {
+			select {
+			case ch <- val:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+func ExampleReadAllContext() {
+	ch := make(chan int, 3)
+	ch <- 1
+	ch <- 2
+	ch <- 3
+	close(ch)
+
+	values, err := chanx.ReadAllContext(context.Background(), ch)
+	fmt.Println(values, err)
+	// Output:
+	// [1 2 3] <nil>
+}
+
+func ExampleReadAllContext_timeout() {
+	ch := make(chan int, 3)
+	ch <- 1
+	ch <- 2 // the channel is never closed
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*5)
+	defer cancel()
+
+	values, err := chanx.ReadAllContext(ctx, ch)
+	fmt.Println(values, err)
+	// Output:
+	// [1 2] context deadline exceeded
+}
+
+func ExampleReadN() {
+	ctx := context.Background()
+	ch := generate(ctx, 1, 2, 3, 4, 5)
+
+	values1, _ := chanx.ReadN(ctx, ch, 2)
+	values2, _ := chanx.ReadN(ctx, ch, 10)
+	fmt.Println(values1)
+	fmt.Println(values2)
+	// Output:
+	// [1 2]
+	// [3 4 5]
+}
+
+func ExampleOrDone() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan int) // never closed
+
+	go func() {
+		for i := 1; ; i++ {
+			ch <- i
+		}
+	}()
+
+	for val := range chanx.OrDone(ctx, ch) {
+		fmt.Println(val)
+
+		if val == 2 {
+			cancel() // the loop ends, without cancelation, it would block forever
+		}
+	}
+	// Output:
+	// 1
+	// 2
+}
+
+func ExampleMerge() {
+	ctx := context.Background()
+	ch := chanx.Merge(ctx, generate(ctx, 1, 2), generate(ctx, 3, 4), generate(ctx, 5))
+
+	values, _ := chanx.ReadAllContext(ctx, ch)
+	slices.Sort(values)
+	fmt.Println(values)
+	// Output:
+	// [1 2 3 4 5]
+}
+
+func ExampleFanOut() {
+	ctx := context.Background()
+	outs := chanx.FanOut(ctx, generate(ctx, 1, 2, 3, 4, 5, 6), 3)
+
+	// each value is received by only one of the workers
+	values, _ := chanx.ReadAllContext(ctx, chanx.Merge(ctx, outs...))
+	slices.Sort(values)
+	fmt.Println(len(outs))
+	fmt.Println(values)
+	// Output:
+	// 3
+	// [1 2 3 4 5 6]
+}
+
+func ExampleTee() {
+	ctx := context.Background()
+	out1, out2 := chanx.Tee(ctx, generate(ctx, 1, 2, 3))
+	values2 := make(chan []int)
+
+	go func() {
+		values, _ := chanx.ReadAllContext(ctx, out2)
+		values2 <- values
+	}()
+
+	values1, _ := chanx.ReadAllContext(ctx, out1)
+	fmt.Println(values1)
+	fmt.Println(<-values2)
+	// Output:
+	// [1 2 3]
+	// [1 2 3]
+}
+
+func ExampleMap() {
+	ctx := context.Background()
+	ch := chanx.Map(ctx, generate(ctx, 1, 2, 3), func(value int) string {
+		return fmt.Sprint(value * 2)
+	})
+
+	values, _ := chanx.ReadAllContext(ctx, ch)
+	fmt.Printf("%q\n", values)
+	// Output:
+	// ["2" "4" "6"]
+}
+
+func ExampleFilter() {
+	ctx := context.Background()
+	ch := chanx.Filter(ctx, generate(ctx, 1, 2, 3, 4, 5), func(value int) bool {
+		return value%2 == 1
+	})
+
+	values, _ := chanx.ReadAllContext(ctx, ch)
+	fmt.Println(values)
+	// Output:
+	// [1 3 5]
+}
+
+func ExampleBatch() {
+	ctx := context.Background()
+	ch := chanx.Batch(ctx, generate(ctx, 1, 2, 3, 4, 5), 2, time.Second)
+
+	for batch := range ch {
+		fmt.Println(batch)
+	}
+	// Output:
+	// [1 2]
+	// [3 4]
+	// [5]
+}
+
+func ExampleBatch_wait() {
+	ctx := context.Background()
+	ch := make(chan int)
+	out := chanx.Batch(ctx, ch, 10, time.Millisecond*5)
+
+	go func() {
+		ch <- 1
+		ch <- 2
+		time.Sleep(time.Millisecond * 20)
+		ch <- 3
+		close(ch)
+	}()
+
+	for batch := range out {
+		fmt.Println(batch)
+	}
+	// Output:
+	// [1 2]
+	// [3]
+}
+
+func ExampleBatch_cancel() {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan int) // never closed
+	out := chanx.Batch(ctx, ch, 10, 0)
+
+	ch <- 1
+	cancel()
+
+	_, ok := <-out // the goroutine exits and closes the channel
+	fmt.Println(ok)
+	// Output:
+	// false
+}
@@ -0,0 +1,282 @@
+package goext
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ayonli/goext/clock"
+	"github.com/ayonli/goext/collections"
+)
+
+// ErrCircuitOpen is returned by the function wrapped by `goext.CircuitBreaker()` when the circuit
+// is open and the call is rejected without invoking the handler function.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets all calls through and counts their failures.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects all calls until the cool-down period has passed.
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of trial calls through to decide whether the circuit
+	// should be closed or opened again.
+	CircuitHalfOpen
+)
+
+func (state CircuitState) String() string {
+	switch state {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerOptions configures the function created by `goext.CircuitBreaker()`.
+type CircuitBreakerOptions struct {
+	// FailureRatio is the ratio of failed calls in the rolling window that opens the circuit,
+	// default 0.5.
+	FailureRatio float64
+	// MinCalls is the minimum number of calls in the rolling window before the failure ratio is
+	// evaluated, default 10.
+	MinCalls int
+	// Window is the time span of the rolling window, default 10 seconds. It's split into 10
+	// buckets, so it's raised to 10 nanoseconds if shorter.
+	Window time.Duration
+	// CoolDown is how long the circuit stays open before it turns half-open, default 5 seconds.
+	CoolDown time.Duration
+	// HalfOpenCalls is the number of trial calls allowed in the half-open state, if all of them
+	// succeed, the circuit is closed, otherwise it's opened again. Default 1.
+	HalfOpenCalls int
+	// IsFailure reports whether the error counts as a failure, by default, all errors do.
+	IsFailure func(err error) bool
+	// OnStateChange is called every time the state of the circuit changes.
+	OnStateChange func(from CircuitState, to CircuitState)
+	// ForKey keeps the state of the circuit in a global registry for the given key, so that
+	// functions created with the same key share the same circuit. For the same key, only the
+	// options of the first created function take effect.
+	ForKey string
+	// Clock is used to measure the rolling window and the cool-down period, default
+	// `clock.Real()`.
+	Clock clock.Clock
+}
+
+const circuitBuckets = 10
+
+type circuitBucket struct {
+	start    time.Time
+	total    int
+	failures int
+}
+
+type circuitBreaker struct {
+	mut      sync.Mutex
+	options  CircuitBreakerOptions
+	state    CircuitState
+	openedAt time.Time
+	buckets  [circuitBuckets]circuitBucket
+	trials   int // trial calls started in the half-open state
+	passed   int // trial calls succeeded in the half-open state
+}
+
+var circuitBreakers = &collections.Map[string, *circuitBreaker]{}
+
+func newCircuitBreaker(options CircuitBreakerOptions) *circuitBreaker {
+	if options.FailureRatio <= 0 {
+		options.FailureRatio = 0.5
+	}
+
+	if options.MinCalls <= 0 {
+		options.MinCalls = 10
+	}
+
+	if options.Window <= 0 {
+		options.Window = time.Second * 10
+	} else if options.Window < circuitBuckets {
+		options.Window = circuitBuckets // each bucket must span at least one nanosecond
+	}
+
+	if options.CoolDown <= 0 {
+		options.CoolDown = time.Second * 5
+	}
+
+	if options.HalfOpenCalls <= 0 {
+		options.HalfOpenCalls = 1
+	}
+
+	options.Clock = clock.Or(options.Clock)
+
+	return &circuitBreaker{options: options}
+}
+
+// transit changes the state and returns a function that fires the callback, which should be
+// called after the lock is released. The caller must hold the lock.
+func (breaker *circuitBreaker) transit(to CircuitState, now time.Time) func() {
+	from := breaker.state
+	breaker.state = to
+	breaker.trials = 0
+	breaker.passed = 0
+
+	if to == CircuitOpen {
+		breaker.openedAt = now
+	} else if to == CircuitClosed {
+		breaker.buckets = [circuitBuckets]circuitBucket{}
+	}
+
+	if breaker.options.OnStateChange == nil || from == to {
+		return func() {}
+	}
+
+	return func() {
+		breaker.options.OnStateChange(from, to)
+	}
+}
+
+// acquire decides whether a call may go through.
+func (breaker *circuitBreaker) acquire() (ok bool, trial bool) {
+	breaker.mut.Lock()
+	notify := func() {}
+	defer func() {
+		breaker.mut.Unlock()
+		notify()
+	}()
+
+	now := breaker.options.Clock.Now()
+
+	if breaker.state == CircuitOpen {
+		if now.Sub(breaker.openedAt) < breaker.options.CoolDown {
+			return false, false
+		}
+
+		notify = breaker.transit(CircuitHalfOpen, now)
+	}
+
+	if breaker.state == CircuitHalfOpen {
+		if breaker.trials >= breaker.options.HalfOpenCalls {
+			return false, false
+		}
+
+		breaker.trials++
+		return true, true
+	}
+
+	return true, false
+}
+
+// bucket returns the bucket of the rolling window for the given time, the caller must hold the
+// lock.
+func (breaker *circuitBreaker) bucket(now time.Time) *circuitBucket {
+	size := breaker.options.Window / circuitBuckets
+	start := now.Truncate(size)
+	bucket := &breaker.buckets[(start.UnixNano()/int64(size))%circuitBuckets]
+
+	if !bucket.start.Equal(start) {
+		*bucket = circuitBucket{start: start}
+	}
+
+	return bucket
+}
+
+// release records the outcome of a call.
+func (breaker *circuitBreaker) release(trial bool, failed bool) {
+	breaker.mut.Lock()
+	notify := func() {}
+	defer func() {
+		breaker.mut.Unlock()
+		notify()
+	}()
+
+	now := breaker.options.Clock.Now()
+
+	if trial {
+		if breaker.state != CircuitHalfOpen {
+			return // the state has been changed by other trial calls
+		} else if failed {
+			notify = breaker.transit(CircuitOpen, now)
+		} else if breaker.passed++; breaker.passed >= breaker.options.HalfOpenCalls {
+			notify = breaker.transit(CircuitClosed, now)
+		}
+
+		return
+	} else if breaker.state != CircuitClosed {
+		return
+	}
+
+	bucket := breaker.bucket(now)
+	bucket.total++
+
+	if failed {
+		bucket.failures++
+	}
+
+	total, failures := 0, 0
+	since := now.Add(-breaker.options.Window)
+
+	for _, bucket := range breaker.buckets {
+		if bucket.start.After(since) {
+			total += bucket.total
+			failures += bucket.failures
+		}
+	}
+
+	if total >= breaker.options.MinCalls &&
+		float64(failures)/float64(total) >= breaker.options.FailureRatio {
+		notify = breaker.transit(CircuitOpen, now)
+	}
+}
+
+// CircuitBreaker wraps the `handler` function with a circuit breaker, which stops invoking the
+// `handler` function for a cool-down period once it fails too often, and returns
+// `goext.ErrCircuitOpen` instead.
+//
+// The circuit starts closed, and opens when the ratio of failed calls in the rolling window
+// reaches `options.FailureRatio`. After `options.CoolDown` has passed, the circuit turns
+// half-open and lets `options.HalfOpenCalls` trial calls through, if all of them succeed, the
+// circuit is closed, otherwise, it's opened again.
+func CircuitBreaker[A any, R any, Fn func(arg A) (R, error)](
+	handler Fn,
+	options CircuitBreakerOptions,
+) Fn {
+	var breaker *circuitBreaker
+
+	if options.ForKey == "" {
+		breaker = newCircuitBreaker(options)
+	} else {
+		breaker = circuitBreakers.Use(options.ForKey, func() *circuitBreaker {
+			return newCircuitBreaker(options)
+		})
+	}
+
+	return func(arg A) (R, error) {
+		ok, trial := breaker.acquire()
+
+		if !ok {
+			return *new(R), ErrCircuitOpen
+		}
+
+		failed := true // a panic counts as a failure
+
+		defer func() {
+			// release even if the handler panics, otherwise the trial slot is never given back
+			breaker.release(trial, failed)
+		}()
+
+		res, err := handler(arg)
+		failed = err != nil && (breaker.options.IsFailure == nil || breaker.options.IsFailure(err))
+
+		return res, err
+	}
+}
+
+// RemoveCircuitBreaker removes the circuit of the given key from the global registry, functions
+// created with the key afterwards start with a new closed circuit.
+func RemoveCircuitBreaker(forKey string) {
+	circuitBreakers.Delete(forKey)
+}
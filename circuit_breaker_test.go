@@ -0,0 +1,253 @@
+package goext_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ayonli/goext"
+	"github.com/ayonli/goext/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func ExampleCircuitBreaker() {
+	fetch := goext.CircuitBreaker(func(n int) (int, error) {
+		if n < 0 {
+			return 0, errors.New("negative number")
+		}
+
+		return n * 2, nil
+	}, goext.CircuitBreakerOptions{
+		MinCalls: 2,
+		CoolDown: time.Minute,
+		OnStateChange: func(from goext.CircuitState, to goext.CircuitState) {
+			fmt.Println(from, "->", to)
+		},
+	})
+
+	fmt.Println(fetch(1))
+	fmt.Println(fetch(-1))
+	fmt.Println(fetch(2)) // rejected without calling the handler
+	// Output:
+	// 2 <nil>
+	// closed -> open
+	// 0 negative number
+	// 0 circuit breaker is open
+}
+
+func TestCircuitBreaker(suit *testing.T) {
+	errFailed := errors.New("failed")
+	newClock := func() *clock.Fake {
+		return clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	}
+	newHandler := func(calls *int) func(fail bool) (bool, error) {
+		return func(fail bool) (bool, error) {
+			*calls++
+
+			if fail {
+				return false, errFailed
+			}
+
+			return true, nil
+		}
+	}
+
+	suit.Run("FailureRatio", func(t *testing.T) {
+		calls := 0
+		fn := goext.CircuitBreaker(newHandler(&calls), goext.CircuitBreakerOptions{
+			FailureRatio: 0.5,
+			MinCalls:     4,
+			CoolDown:     time.Minute,
+		})
+
+		fn(false)
+		fn(true)
+		fn(false)
+		_, err := fn(false) // 1 of 4 failed
+		assert.Nil(t, err)
+
+		fn(true)
+		fn(true) // 3 of 6 failed
+		_, err = fn(false)
+		assert.Equal(t, goext.ErrCircuitOpen, err)
+		assert.Equal(t, 6, calls)
+	})
+
+	suit.Run("HalfOpen", func(t *testing.T) {
+		calls := 0
+		states := []string{}
+		fake := newClock()
+		fn := goext.CircuitBreaker(newHandler(&calls), goext.CircuitBreakerOptions{
+			MinCalls:      1,
+			CoolDown:      time.Millisecond * 10,
+			HalfOpenCalls: 2,
+			Clock:         fake,
+			OnStateChange: func(from goext.CircuitState, to goext.CircuitState) {
+				states = append(states, to.String())
+			},
+		})
+
+		fn(true)
+		_, err := fn(false)
+		assert.Equal(t, goext.ErrCircuitOpen, err)
+
+		// the trial call fails, so the circuit is opened again
+		fake.Advance(time.Millisecond * 10)
+		_, err = fn(true)
+		assert.Equal(t, errFailed, err)
+		_, err = fn(false)
+		assert.Equal(t, goext.ErrCircuitOpen, err)
+
+		// all trial calls succeed, so the circuit is closed
+		fake.Advance(time.Millisecond * 10)
+		fn(false)
+		fn(false)
+		_, err = fn(false)
+		assert.Nil(t, err)
+
+		assert.Equal(t, 5, calls)
+		assert.Equal(t, []string{"open", "half-open", "open", "half-open", "closed"}, states)
+	})
+
+	suit.Run("HalfOpenCalls", func(t *testing.T) {
+		fake := newClock()
+		release := make(chan struct{})
+		fn := goext.CircuitBreaker(func(wait bool) (bool, error) {
+			if !wait {
+				return false, errFailed
+			}
+
+			<-release
+			return true, nil
+		}, goext.CircuitBreakerOptions{
+			MinCalls: 1,
+			CoolDown: time.Millisecond * 5,
+			Clock:    fake,
+		})
+
+		fn(false)
+		fake.Advance(time.Millisecond * 5)
+
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := fn(true)
+			assert.Nil(t, err)
+		}()
+
+		// only one trial call is allowed at a time
+		assert.Eventually(t, func() bool {
+			_, err := fn(true)
+			return err == goext.ErrCircuitOpen
+		}, time.Second, time.Millisecond)
+
+		close(release)
+		wg.Wait()
+
+		_, err := fn(true)
+		assert.Nil(t, err)
+	})
+
+	suit.Run("Window", func(t *testing.T) {
+		calls := 0
+		fake := newClock()
+		fn := goext.CircuitBreaker(newHandler(&calls), goext.CircuitBreakerOptions{
+			MinCalls: 2,
+			Window:   time.Millisecond * 20,
+			CoolDown: time.Minute,
+			Clock:    fake,
+		})
+
+		fn(true)
+		fake.Advance(time.Millisecond * 20) // the first failure leaves the window
+		fn(true)
+		_, err := fn(false)
+		assert.Nil(t, err)
+
+		// 1 of 2 failed in the window
+		_, err = fn(false)
+		assert.Equal(t, goext.ErrCircuitOpen, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	suit.Run("IsFailure", func(t *testing.T) {
+		fn := goext.CircuitBreaker(func(ctx context.Context) (bool, error) {
+			return false, ctx.Err()
+		}, goext.CircuitBreakerOptions{
+			MinCalls: 1,
+			IsFailure: func(err error) bool {
+				return !errors.Is(err, context.Canceled)
+			},
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		for i := 0; i < 3; i++ {
+			_, err := fn(ctx)
+			assert.Equal(t, context.Canceled, err)
+		}
+	})
+
+	suit.Run("panic", func(t *testing.T) {
+		fake := newClock()
+		fn := goext.CircuitBreaker(func(fail bool) (int, error) {
+			if fail {
+				panic("something went wrong")
+			}
+
+			return 1, nil
+		}, goext.CircuitBreakerOptions{
+			MinCalls: 1,
+			CoolDown: time.Millisecond * 5,
+			Clock:    fake,
+		})
+
+		// the panic counts as a failure
+		assert.Panics(t, func() { fn(true) })
+		_, err := fn(false)
+		assert.Equal(t, goext.ErrCircuitOpen, err)
+
+		// the panicking trial call opens the circuit again, rather than holding the trial slot
+		fake.Advance(time.Millisecond * 5)
+		assert.Panics(t, func() { fn(true) })
+		_, err = fn(false)
+		assert.Equal(t, goext.ErrCircuitOpen, err)
+
+		fake.Advance(time.Millisecond * 5)
+		res, err := fn(false)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, res)
+	})
+
+	suit.Run("tinyWindow", func(t *testing.T) {
+		fn := goext.CircuitBreaker(func(arg int) (int, error) {
+			return arg, nil
+		}, goext.CircuitBreakerOptions{Window: time.Nanosecond})
+
+		res, err := fn(1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, res)
+	})
+
+	suit.Run("ForKey", func(t *testing.T) {
+		calls := 0
+		options := goext.CircuitBreakerOptions{
+			MinCalls: 1,
+			CoolDown: time.Minute,
+			ForKey:   "circuit-test",
+		}
+		fn1 := goext.CircuitBreaker(newHandler(&calls), options)
+		fn2 := goext.CircuitBreaker(newHandler(&calls), options)
+		defer goext.RemoveCircuitBreaker("circuit-test")
+
+		fn1(true)
+		_, err := fn2(false)
+		assert.Equal(t, goext.ErrCircuitOpen, err)
+		assert.Equal(t, 1, calls)
+	})
+}
@@ -0,0 +1,255 @@
+// Package clock provides an abstraction of time, so that time-dependent code can be tested with a
+// fake clock instead of waiting for the real time to pass.
+package clock
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the current time and creates timers.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// Since returns the time elapsed since `t`.
+	Since(t time.Time) time.Duration
+	// Sleep pauses the current goroutine for at least the duration `d`.
+	Sleep(d time.Duration)
+	// After waits for the duration to elapse and then sends the current time on the returned
+	// channel.
+	After(d time.Duration) <-chan time.Time
+	// NewTimer creates a new timer that sends the current time on its channel after at least the
+	// duration `d`.
+	NewTimer(d time.Duration) Timer
+	// AfterFunc waits for the duration to elapse and then calls `f`.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is the counterpart of `time.Timer` created by a `Clock`.
+type Timer interface {
+	// C returns the channel on which the time is delivered, it's nil for timers created by
+	// `Clock.AfterFunc()`.
+	C() <-chan time.Time
+	// Stop prevents the timer from firing, it returns false if the timer has already expired or
+	// been stopped.
+	Stop() bool
+	// Reset changes the timer to expire after the duration `d`, it returns true if the timer had
+	// been active.
+	Reset(d time.Duration) bool
+}
+
+type realClock struct{}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (timer realTimer) C() <-chan time.Time {
+	return timer.Timer.C
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+// Real returns the clock backed by the `time` package.
+func Real() Clock {
+	return realClock{}
+}
+
+// Or returns the given clock, or the real clock if it's nil. It's useful for options that accept an
+// optional clock.
+func Or(c Clock) Clock {
+	if c == nil {
+		return realClock{}
+	}
+
+	return c
+}
+
+// Fake is a clock that only moves forward when it's told to, the timers created by it fire
+// synchronously during `Advance()` or `Set()`, in the order of their expiration time.
+type Fake struct {
+	mut    sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock *Fake
+	at    time.Time
+	ch    chan time.Time
+	fn    func()
+}
+
+// NewFake creates a fake clock starting at the given time.
+func NewFake(now time.Time) *Fake {
+	fake := &Fake{now: now}
+	fake.cond = sync.NewCond(&fake.mut)
+	return fake
+}
+
+func (fake *Fake) Now() time.Time {
+	fake.mut.Lock()
+	defer fake.mut.Unlock()
+
+	return fake.now
+}
+
+func (fake *Fake) Since(t time.Time) time.Duration {
+	return fake.Now().Sub(t)
+}
+
+func (fake *Fake) Sleep(d time.Duration) {
+	<-fake.After(d)
+}
+
+func (fake *Fake) After(d time.Duration) <-chan time.Time {
+	return fake.NewTimer(d).C()
+}
+
+func (fake *Fake) NewTimer(d time.Duration) Timer {
+	timer := &fakeTimer{clock: fake, ch: make(chan time.Time, 1)}
+	timer.Reset(d)
+	return timer
+}
+
+func (fake *Fake) AfterFunc(d time.Duration, f func()) Timer {
+	timer := &fakeTimer{clock: fake, fn: f}
+	timer.Reset(d)
+	return timer
+}
+
+// Advance moves the clock forward by the duration `d`, and fires the timers expiring by then.
+func (fake *Fake) Advance(d time.Duration) {
+	fake.Set(fake.Now().Add(d))
+}
+
+// Set moves the clock to the given time, and fires the timers expiring by then. Timers created or
+// reset by the fired ones fire as well if they expire by then, and the clock reports the
+// expiration time of the firing timer while it fires.
+func (fake *Fake) Set(t time.Time) {
+	for {
+		fake.mut.Lock()
+
+		if len(fake.timers) == 0 || fake.timers[0].at.After(t) {
+			if t.After(fake.now) {
+				fake.now = t
+			}
+
+			fake.mut.Unlock()
+			return
+		}
+
+		timer := fake.timers[0]
+		fake.timers = fake.timers[1:]
+
+		if timer.at.After(fake.now) {
+			fake.now = timer.at
+		}
+
+		now := fake.now
+		fake.cond.Broadcast()
+		fake.mut.Unlock()
+
+		if timer.fn != nil {
+			timer.fn()
+		} else {
+			select {
+			case timer.ch <- now:
+			default:
+			}
+		}
+	}
+}
+
+// BlockUntil blocks until there are at least `n` active timers, which is useful to wait for the
+// code under test to start waiting on the clock before advancing it.
+func (fake *Fake) BlockUntil(n int) {
+	fake.mut.Lock()
+	defer fake.mut.Unlock()
+
+	for len(fake.timers) < n {
+		fake.cond.Wait()
+	}
+}
+
+// remove removes the timer from the active list, the caller must hold the lock.
+func (fake *Fake) remove(timer *fakeTimer) bool {
+	for i, item := range fake.timers {
+		if item == timer {
+			fake.timers = slices.Delete(fake.timers, i, i+1)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (timer *fakeTimer) C() <-chan time.Time {
+	return timer.ch
+}
+
+func (timer *fakeTimer) Stop() bool {
+	fake := timer.clock
+	fake.mut.Lock()
+	defer fake.mut.Unlock()
+
+	ok := fake.remove(timer)
+	fake.cond.Broadcast()
+	return ok
+}
+
+func (timer *fakeTimer) Reset(d time.Duration) bool {
+	fake := timer.clock
+	fake.mut.Lock()
+	defer fake.mut.Unlock()
+
+	active := fake.remove(timer)
+	timer.at = fake.now.Add(d)
+	fake.cond.Broadcast()
+
+	if d <= 0 {
+		// fire immediately like the real timers do
+		if timer.fn != nil {
+			go timer.fn()
+		} else {
+			select {
+			case timer.ch <- fake.now:
+			default:
+			}
+		}
+
+		return active
+	}
+
+	idx := sort.Search(len(fake.timers), func(i int) bool {
+		return fake.timers[i].at.After(timer.at)
+	})
+	fake.timers = slices.Insert(fake.timers, idx, timer)
+
+	return active
+}
@@ -0,0 +1,42 @@
+package clock_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ayonli/goext/clock"
+)
+
+func ExampleFake() {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	timer := fake.NewTimer(time.Minute)
+
+	fake.AfterFunc(time.Second*30, func() {
+		fmt.Println("AfterFunc:", fake.Now().Format(time.TimeOnly))
+	})
+
+	fake.Advance(time.Minute * 2)
+	fmt.Println("Timer:", (<-timer.C()).Format(time.TimeOnly))
+	fmt.Println("Now:", fake.Now().Format(time.TimeOnly))
+	// Output:
+	// AfterFunc: 00:00:30
+	// Timer: 00:01:00
+	// Now: 00:02:00
+}
+
+func ExampleFake_BlockUntil() {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	done := make(chan struct{})
+
+	go func() {
+		fake.Sleep(time.Hour)
+		close(done)
+	}()
+
+	fake.BlockUntil(1) // wait for the goroutine to start sleeping
+	fake.Advance(time.Hour)
+	<-done
+	fmt.Println(fake.Now().Format(time.TimeOnly))
+	// Output:
+	// 01:00:00
+}
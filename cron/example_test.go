@@ -0,0 +1,248 @@
+package cron_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ayonli/goext"
+	"github.com/ayonli/goext/clock"
+	"github.com/ayonli/goext/cron"
+	"github.com/stretchr/testify/assert"
+)
+
+func ExampleParse() {
+	schedule, _ := cron.Parse("30 9 * * MON-FRI")
+	t := time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC) // Friday
+
+	for i := 0; i < 3; i++ {
+		t = schedule.Next(t)
+		fmt.Println(t.Format("Mon 2006-01-02 15:04"))
+	}
+	// Output:
+	// Mon 2024-01-08 09:30
+	// Tue 2024-01-09 09:30
+	// Wed 2024-01-10 09:30
+}
+
+func ExampleScheduler() {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	scheduler := cron.NewScheduler(cron.SchedulerOptions{Clock: fake})
+	defer scheduler.Stop()
+
+	runs := make(chan time.Time)
+	scheduler.Add("*/15 * * * *", func() error {
+		runs <- fake.Now()
+		return nil
+	}, cron.JobOptions{Id: "report"})
+
+	for i := 0; i < 3; i++ {
+		fake.Advance(time.Minute * 15)
+		fmt.Println((<-runs).Format(time.TimeOnly))
+	}
+
+	// Output:
+	// 00:15:00
+	// 00:30:00
+	// 00:45:00
+}
+
+func ExampleScheduler_Pause() {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	scheduler := cron.NewScheduler(cron.SchedulerOptions{Clock: fake})
+	defer scheduler.Stop()
+
+	runs := make(chan time.Time)
+	id, _ := scheduler.AddInterval(time.Minute, func() error {
+		runs <- fake.Now()
+		return nil
+	}, cron.JobOptions{})
+
+	scheduler.Pause(id)
+	fake.Advance(time.Minute * 5) // nothing runs while paused
+
+	scheduler.Resume(id)
+	fake.Advance(time.Minute)
+	fmt.Println((<-runs).Format(time.TimeOnly))
+	// Output:
+	// 00:06:00
+}
+
+func TestParse(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) // Monday
+	next := func(expr string, after time.Time) string {
+		schedule, err := cron.Parse(expr)
+		assert.Nil(t, err, expr)
+		return schedule.Next(after).Format(time.DateTime)
+	}
+
+	assert.Equal(t, "2024-01-01 00:01:00", next("* * * * *", start))
+	assert.Equal(t, "2024-01-01 00:00:10", next("*/10 * * * * *", start))
+	assert.Equal(t, "2024-01-01 02:05:00", next("5 2-4 * * *", start))
+	assert.Equal(t, "2024-01-01 00:20:00", next("0-40/20 * * * *", start.Add(time.Minute)))
+	assert.Equal(t, "2024-01-01 00:45:00", next("45/5 * * * *", start))
+	assert.Equal(t, "2024-03-01 00:00:00", next("0 0 1 mar,jun *", start))
+	assert.Equal(t, "2024-01-07 00:00:00", next("0 0 * * 7", start))
+	assert.Equal(t, "2024-01-07 00:00:00", next("@weekly", start))
+	assert.Equal(t, "2024-01-02 00:00:00", next("@daily", start))
+	assert.Equal(t, "2024-01-01 01:00:00", next("@hourly", start))
+	assert.Equal(t, "2025-01-01 00:00:00", next("@yearly", start))
+	assert.Equal(t, "2024-01-01 00:00:30", next("@every 30s", start))
+	assert.Equal(t, "2024-02-29 00:00:00", next("0 0 29 2 *", start))
+
+	// when both day fields are restricted, either of them matches
+	assert.Equal(t, "2024-01-05 00:00:00", next("0 0 15 * FRI", start))
+
+	// a day field starting with `*` is unrestricted, so both of them must match
+	assert.Equal(t, "2024-01-15 00:00:00", next("0 0 */2 * MON", start))
+
+	for _, expr := range []string{
+		"* * * *",
+		"60 * * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"@every -1s",
+		"@often",
+	} {
+		_, err := cron.Parse(expr)
+		assert.NotNil(t, err, expr)
+	}
+
+	schedule := cron.MustParse("0 0 30 2 *") // never matches
+	assert.True(t, schedule.Next(start).IsZero())
+}
+
+func TestScheduler(suit *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	suit.Run("overlap", func(t *testing.T) {
+		for _, c := range []struct {
+			policy cron.OverlapPolicy
+			runs   int
+		}{
+			{cron.OverlapSkip, 1},
+			{cron.OverlapQueue, 3},
+			{cron.OverlapAllow, 3},
+		} {
+			fake := clock.NewFake(start)
+			scheduler := cron.NewScheduler(cron.SchedulerOptions{Clock: fake})
+			started := make(chan struct{}, 10)
+			release := make(chan struct{})
+
+			scheduler.AddInterval(time.Minute, func() error {
+				started <- struct{}{}
+				<-release
+				return nil
+			}, cron.JobOptions{Overlap: c.policy})
+
+			fake.Advance(time.Minute)
+			<-started
+
+			// due twice while the first run is ongoing
+			fake.Advance(time.Minute)
+			fake.Advance(time.Minute)
+
+			close(release)
+
+			for i := 1; i < c.runs; i++ {
+				<-started
+			}
+
+			scheduler.Stop()
+			assert.Equal(t, 0, len(started), c.policy)
+		}
+	})
+
+	suit.Run("Jitter", func(t *testing.T) {
+		fake := clock.NewFake(start)
+		scheduler := cron.NewScheduler(cron.SchedulerOptions{Clock: fake})
+		defer scheduler.Stop()
+
+		runs := make(chan time.Time)
+		scheduler.Add("0 * * * *", func() error {
+			runs <- fake.Now()
+			return nil
+		}, cron.JobOptions{Jitter: time.Minute})
+
+		for i := 1; i <= 3; i++ {
+			scheduled := start.Add(time.Hour * time.Duration(i))
+			fake.BlockUntil(1)
+			fake.Set(scheduled.Add(time.Minute))
+			<-runs // runs within the jitter
+
+			// the jitter doesn't shift the schedule
+			next, _ := scheduler.Next("job-1")
+			assert.Equal(t, scheduled.Add(time.Hour), next)
+		}
+	})
+
+	suit.Run("Remove", func(t *testing.T) {
+		fake := clock.NewFake(start)
+		scheduler := cron.NewScheduler(cron.SchedulerOptions{Clock: fake})
+		defer scheduler.Stop()
+
+		runs := make(chan time.Time, 10)
+		id, _ := scheduler.AddInterval(time.Minute, func() error {
+			runs <- fake.Now()
+			return nil
+		}, cron.JobOptions{Id: "foo"})
+
+		assert.Equal(t, "foo", id)
+		assert.Nil(t, scheduler.Remove(id))
+		fake.Advance(time.Hour)
+		assert.Equal(t, 0, len(runs))
+
+		assert.Equal(t, cron.ErrJobNotFound, scheduler.Remove(id))
+		assert.Equal(t, cron.ErrJobNotFound, scheduler.Pause(id))
+		assert.Equal(t, cron.ErrJobNotFound, scheduler.Resume(id))
+	})
+
+	suit.Run("OnError", func(t *testing.T) {
+		fake := clock.NewFake(start)
+		errs := make(chan error)
+		scheduler := cron.NewScheduler(cron.SchedulerOptions{
+			Clock: fake,
+			OnError: func(id string, err error) {
+				errs <- fmt.Errorf("%s: %w", id, err)
+			},
+		})
+		defer scheduler.Stop()
+
+		scheduler.AddInterval(time.Minute, func() error {
+			return errors.New("something went wrong")
+		}, cron.JobOptions{Id: "error"})
+		scheduler.AddInterval(time.Minute, func() error {
+			panic("something went wrong")
+		}, cron.JobOptions{Id: "panic"})
+
+		fake.Advance(time.Minute)
+		messages := []string{}
+		var panicErr *goext.PanicError
+
+		for i := 0; i < 2; i++ {
+			err := <-errs
+			messages = append(messages, err.Error())
+
+			if errors.As(err, &panicErr) {
+				assert.Equal(t, "something went wrong", panicErr.Value)
+			}
+		}
+
+		assert.ElementsMatch(t, []string{
+			"error: something went wrong",
+			"panic: something went wrong",
+		}, messages)
+		assert.NotNil(t, panicErr)
+	})
+
+	suit.Run("Stop", func(t *testing.T) {
+		scheduler := cron.NewScheduler(cron.SchedulerOptions{})
+		scheduler.Stop()
+
+		_, err := scheduler.AddInterval(time.Minute, func() error { return nil }, cron.JobOptions{})
+		assert.Equal(t, cron.ErrSchedulerStopped, err)
+	})
+}
@@ -0,0 +1,254 @@
+// Package cron provides a scheduler that runs jobs periodically by cron expressions or fixed
+// intervals.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule decides when a job runs.
+type Schedule interface {
+	// Next returns the next time after `t` that the job should run, or the zero time if there is
+	// no such time.
+	Next(t time.Time) time.Time
+}
+
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+func (schedule intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(schedule.interval)
+}
+
+// Returns a schedule that runs the job at a fixed interval, the first run happens one interval
+// after the job is added. The interval is rounded up to at least one millisecond.
+func Every(interval time.Duration) Schedule {
+	return intervalSchedule{interval: max(interval, time.Millisecond)}
+}
+
+// exprSchedule is a parsed cron expression, each field is a bit set of the allowed values.
+type exprSchedule struct {
+	second uint64
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// whether the day-of-month or the day-of-week field is restricted, if both are, a day matches
+	// when either of them does, as the standard cron does
+	domAny bool
+	dowAny bool
+}
+
+type fieldBounds struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	secondBounds = fieldBounds{name: "second", min: 0, max: 59}
+	minuteBounds = fieldBounds{name: "minute", min: 0, max: 59}
+	hourBounds   = fieldBounds{name: "hour", min: 0, max: 23}
+	domBounds    = fieldBounds{name: "day of month", min: 1, max: 31}
+	monthBounds  = fieldBounds{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is also Sunday, it's folded into 0 after parsing
+	dowBounds = fieldBounds{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// Parses a cron expression into a schedule.
+//
+// The expression consists of 5 fields (minute, hour, day of month, month and day of week), or 6
+// fields with a leading second field. Each field accepts `*`, single values, ranges such as
+// `1-5`, steps such as `*/15` or `0-30/10`, and comma-separated lists of them. The month and day
+// of week fields also accept the English abbreviations, such as `JAN` and `MON`, and both 0 and 7
+// stand for Sunday.
+//
+// The descriptors `@yearly` (or `@annually`), `@monthly`, `@weekly`, `@daily` (or `@midnight`),
+// `@hourly` and `@every <duration>` are supported as well.
+//
+// The times of the schedule are in the location of the time passed to `Schedule.Next()`.
+func Parse(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+
+	if rest, ok := strings.CutPrefix(expr, "@every "); ok {
+		interval, err := time.ParseDuration(strings.TrimSpace(rest))
+
+		if err != nil {
+			return nil, fmt.Errorf("cron: invalid interval %q: %w", rest, err)
+		} else if interval <= 0 {
+			return nil, fmt.Errorf("cron: invalid interval %q: must be positive", rest)
+		}
+
+		return Every(interval), nil
+	} else if spec, ok := descriptors[strings.ToLower(expr)]; ok {
+		expr = spec
+	} else if strings.HasPrefix(expr, "@") {
+		return nil, fmt.Errorf("cron: unknown descriptor %q", expr)
+	}
+
+	fields := strings.Fields(expr)
+
+	if len(fields) == 5 {
+		fields = append([]string{"0"}, fields...)
+	} else if len(fields) != 6 {
+		return nil, fmt.Errorf("cron: expected 5 or 6 fields, got %d in %q", len(fields), expr)
+	}
+
+	schedule := &exprSchedule{}
+	var err error
+
+	for i, target := range []struct {
+		bits   *uint64
+		bounds fieldBounds
+	}{
+		{&schedule.second, secondBounds},
+		{&schedule.minute, minuteBounds},
+		{&schedule.hour, hourBounds},
+		{&schedule.dom, domBounds},
+		{&schedule.month, monthBounds},
+		{&schedule.dow, dowBounds},
+	} {
+		if *target.bits, err = parseField(fields[i], target.bounds); err != nil {
+			return nil, err
+		}
+	}
+
+	if schedule.dow&(1<<7) != 0 {
+		schedule.dow = schedule.dow&^(1<<7) | 1
+	}
+
+	// like the standard cron, a field starting with `*`, such as `*/2`, counts as unrestricted
+	schedule.domAny = strings.HasPrefix(fields[3], "*") || fields[3] == "?"
+	schedule.dowAny = strings.HasPrefix(fields[5], "*") || fields[5] == "?"
+
+	return schedule, nil
+}
+
+// Like `Parse()`, but panics if the expression is invalid.
+func MustParse(expr string) Schedule {
+	schedule, err := Parse(expr)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return schedule
+}
+
+func parseField(field string, bounds fieldBounds) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		start, end := bounds.min, bounds.max
+		step := 1
+
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("cron: invalid step %q in %s field", stepPart, bounds.name)
+			}
+
+			step = n
+		}
+
+		if rangePart != "*" && rangePart != "?" {
+			low, high, isRange := strings.Cut(rangePart, "-")
+			var err error
+
+			if start, err = parseValue(low, bounds); err != nil {
+				return 0, err
+			}
+
+			if isRange {
+				if end, err = parseValue(high, bounds); err != nil {
+					return 0, err
+				} else if end < start {
+					return 0, fmt.Errorf("cron: invalid range %q in %s field", rangePart, bounds.name)
+				}
+			} else if !hasStep {
+				end = start
+			}
+		}
+
+		for i := start; i <= end; i += step {
+			bits |= 1 << i
+		}
+	}
+
+	return bits, nil
+}
+
+func parseValue(value string, bounds fieldBounds) (int, error) {
+	if n, ok := bounds.names[strings.ToLower(value)]; ok {
+		return n, nil
+	}
+
+	n, err := strconv.Atoi(value)
+
+	if err != nil || n < bounds.min || n > bounds.max {
+		return 0, fmt.Errorf("cron: invalid value %q in %s field", value, bounds.name)
+	}
+
+	return n, nil
+}
+
+func (schedule *exprSchedule) matchDay(t time.Time) bool {
+	domMatch := schedule.dom&(1<<t.Day()) != 0
+	dowMatch := schedule.dow&(1<<t.Weekday()) != 0
+
+	if schedule.domAny || schedule.dowAny {
+		return domMatch && dowMatch
+	}
+
+	return domMatch || dowMatch
+}
+
+func (schedule *exprSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Add(time.Second - time.Duration(t.Nanosecond()))
+	limit := t.Year() + 5 // a valid expression always matches within a few years
+
+	for t.Year() <= limit {
+		year, month, day := t.Date()
+		hour, minute, second := t.Clock()
+
+		if schedule.month&(1<<month) == 0 {
+			t = time.Date(year, month+1, 1, 0, 0, 0, 0, loc)
+		} else if !schedule.matchDay(t) {
+			t = time.Date(year, month, day+1, 0, 0, 0, 0, loc)
+		} else if schedule.hour&(1<<hour) == 0 {
+			t = time.Date(year, month, day, hour+1, 0, 0, 0, loc)
+		} else if schedule.minute&(1<<minute) == 0 {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+		} else if schedule.second&(1<<second) == 0 {
+			t = t.Add(time.Second)
+		} else {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
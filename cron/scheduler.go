@@ -0,0 +1,333 @@
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ayonli/goext"
+	"github.com/ayonli/goext/clock"
+)
+
+// ErrJobNotFound is returned when operating a job that doesn't exist in the scheduler.
+var ErrJobNotFound = errors.New("cron: job not found")
+
+// ErrSchedulerStopped is returned when adding a job to a stopped scheduler.
+var ErrSchedulerStopped = errors.New("cron: scheduler stopped")
+
+// OverlapPolicy decides what happens when a job is due while its previous run hasn't finished.
+type OverlapPolicy int
+
+const (
+	// OverlapSkip skips the run, this is the default policy.
+	OverlapSkip OverlapPolicy = iota
+	// OverlapQueue postpones the run until the previous ones finish, the runs of the job never
+	// overlap and none of them is skipped.
+	OverlapQueue
+	// OverlapAllow starts the run concurrently.
+	OverlapAllow
+)
+
+// JobOptions configures a job added to the scheduler.
+type JobOptions struct {
+	// Id identifies the job in the scheduler, by default, a unique ID is generated.
+	Id string
+	// Jitter delays each run by a random duration in `[0, Jitter)`, which is useful to avoid
+	// many instances running the same job at the same moment. The jitter doesn't shift the
+	// schedule, the next run is still computed from the scheduled time.
+	Jitter time.Duration
+	// Overlap decides what happens when a run is due while the previous one is still running.
+	Overlap OverlapPolicy
+}
+
+// SchedulerOptions configures the scheduler created by `NewScheduler()`.
+type SchedulerOptions struct {
+	// Clock provides the time for the scheduler, default `clock.Real()`. A fake clock can be used
+	// in tests to run the jobs without waiting for the real time to pass.
+	Clock clock.Clock
+	// OnError is called with the job ID when a run of the job returns an error or panics, the
+	// panic is recovered and converted to a `*goext.PanicError`.
+	OnError func(id string, err error)
+}
+
+type job struct {
+	id       string
+	schedule Schedule
+	fn       func() error
+	options  JobOptions
+	next     time.Time // the scheduled time of the next run, without jitter
+	timer    clock.Timer
+	gen      int // increased every time the timer is set, to tell outdated timers
+	paused   bool
+	removed  bool
+	running  int // the number of ongoing runs
+	queued   int // the number of runs waiting for the ongoing one under `OverlapQueue`
+}
+
+// Scheduler runs jobs periodically according to their schedules.
+type Scheduler struct {
+	mut     sync.Mutex
+	clock   clock.Clock
+	onError func(id string, err error)
+	jobs    map[string]*job
+	seq     int
+	stopped bool
+	runs    sync.WaitGroup
+}
+
+// Creates a new scheduler, jobs start running as soon as they're added.
+func NewScheduler(options SchedulerOptions) *Scheduler {
+	return &Scheduler{
+		clock:   clock.Or(options.Clock),
+		onError: options.OnError,
+		jobs:    map[string]*job{},
+	}
+}
+
+// Adds a job that runs by the given cron expression, see `Parse()` for the syntax, and returns
+// the ID of the job.
+func (scheduler *Scheduler) Add(expr string, fn func() error, options JobOptions) (string, error) {
+	schedule, err := Parse(expr)
+
+	if err != nil {
+		return "", err
+	}
+
+	return scheduler.AddSchedule(schedule, fn, options)
+}
+
+// Adds a job that runs at a fixed interval, and returns the ID of the job.
+func (scheduler *Scheduler) AddInterval(
+	interval time.Duration,
+	fn func() error,
+	options JobOptions,
+) (string, error) {
+	return scheduler.AddSchedule(Every(interval), fn, options)
+}
+
+// Adds a job that runs by the given schedule, and returns the ID of the job. If a job with the
+// same ID already exists, it's replaced, while its ongoing runs are not affected.
+func (scheduler *Scheduler) AddSchedule(
+	schedule Schedule,
+	fn func() error,
+	options JobOptions,
+) (string, error) {
+	scheduler.mut.Lock()
+	defer scheduler.mut.Unlock()
+
+	if scheduler.stopped {
+		return "", ErrSchedulerStopped
+	}
+
+	if options.Id == "" {
+		scheduler.seq++
+		options.Id = fmt.Sprintf("job-%d", scheduler.seq)
+	}
+
+	if old, ok := scheduler.jobs[options.Id]; ok {
+		scheduler.cancel(old)
+	}
+
+	job := &job{
+		id:       options.Id,
+		schedule: schedule,
+		fn:       fn,
+		options:  options,
+	}
+	scheduler.jobs[job.id] = job
+	scheduler.arm(job, scheduler.clock.Now())
+
+	return job.id, nil
+}
+
+// arm sets the timer for the next run of the job after the given time, the caller must hold the
+// lock.
+func (scheduler *Scheduler) arm(job *job, after time.Time) {
+	now := scheduler.clock.Now()
+	job.gen++
+	job.next = job.schedule.Next(after)
+
+	if !job.next.IsZero() && job.next.Before(now) {
+		// the scheduler has fallen behind, skip the missed runs instead of making them up in a row
+		job.next = job.schedule.Next(now)
+	}
+
+	if job.next.IsZero() {
+		job.timer = nil
+		return
+	}
+
+	delay := job.next.Sub(now)
+
+	if job.options.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(job.options.Jitter)))
+	}
+
+	gen := job.gen
+	job.timer = scheduler.clock.AfterFunc(delay, func() {
+		scheduler.fire(job, gen)
+	})
+}
+
+// cancel stops the timer of the job and marks it removed, the caller must hold the lock.
+func (scheduler *Scheduler) cancel(job *job) {
+	job.removed = true
+
+	if job.timer != nil {
+		job.timer.Stop()
+		job.timer = nil
+	}
+}
+
+func (scheduler *Scheduler) fire(job *job, gen int) {
+	scheduler.mut.Lock()
+	defer scheduler.mut.Unlock()
+
+	if job.removed || job.paused || job.gen != gen {
+		return // the timer is outdated
+	}
+
+	scheduler.arm(job, job.next)
+
+	if job.running > 0 {
+		switch job.options.Overlap {
+		case OverlapSkip:
+			return
+		case OverlapQueue:
+			job.queued++
+			return
+		}
+	}
+
+	scheduler.start(job)
+}
+
+// start runs the job in a new goroutine, the caller must hold the lock.
+func (scheduler *Scheduler) start(job *job) {
+	job.running++
+	scheduler.runs.Add(1)
+
+	go func() {
+		defer scheduler.runs.Done()
+
+		for {
+			err, re := goext.Try(job.fn)
+
+			if re != nil {
+				err = re
+			}
+
+			if err != nil && scheduler.onError != nil {
+				scheduler.onError(job.id, err)
+			}
+
+			scheduler.mut.Lock()
+
+			if job.queued > 0 && !job.removed && !scheduler.stopped {
+				job.queued--
+				scheduler.mut.Unlock()
+				continue
+			}
+
+			job.queued = 0
+			job.running--
+			scheduler.mut.Unlock()
+			return
+		}
+	}()
+}
+
+// Pauses the job so that no more runs are started until it's resumed, the ongoing runs are not
+// affected.
+func (scheduler *Scheduler) Pause(id string) error {
+	scheduler.mut.Lock()
+	defer scheduler.mut.Unlock()
+
+	job, ok := scheduler.jobs[id]
+
+	if !ok {
+		return ErrJobNotFound
+	} else if job.paused {
+		return nil
+	}
+
+	job.paused = true
+
+	if job.timer != nil {
+		job.timer.Stop()
+		job.timer = nil
+	}
+
+	return nil
+}
+
+// Resumes a paused job, the runs missed during the pause are not made up, the next run is
+// computed from the current time.
+func (scheduler *Scheduler) Resume(id string) error {
+	scheduler.mut.Lock()
+	defer scheduler.mut.Unlock()
+
+	job, ok := scheduler.jobs[id]
+
+	if !ok {
+		return ErrJobNotFound
+	} else if !job.paused {
+		return nil
+	}
+
+	job.paused = false
+	scheduler.arm(job, scheduler.clock.Now())
+
+	return nil
+}
+
+// Removes the job from the scheduler, the ongoing run is not interrupted, but the queued runs are
+// discarded.
+func (scheduler *Scheduler) Remove(id string) error {
+	scheduler.mut.Lock()
+	defer scheduler.mut.Unlock()
+
+	job, ok := scheduler.jobs[id]
+
+	if !ok {
+		return ErrJobNotFound
+	}
+
+	scheduler.cancel(job)
+	delete(scheduler.jobs, id)
+
+	return nil
+}
+
+// Returns the scheduled time of the next run of the job, or the zero time if the job is paused or
+// has no more runs.
+func (scheduler *Scheduler) Next(id string) (time.Time, error) {
+	scheduler.mut.Lock()
+	defer scheduler.mut.Unlock()
+
+	job, ok := scheduler.jobs[id]
+
+	if !ok {
+		return time.Time{}, ErrJobNotFound
+	} else if job.paused {
+		return time.Time{}, nil
+	}
+
+	return job.next, nil
+}
+
+// Stops the scheduler and removes all the jobs, then waits for the ongoing runs to finish.
+func (scheduler *Scheduler) Stop() {
+	scheduler.mut.Lock()
+	scheduler.stopped = true
+
+	for id, job := range scheduler.jobs {
+		scheduler.cancel(job)
+		delete(scheduler.jobs, id)
+	}
+
+	scheduler.mut.Unlock()
+	scheduler.runs.Wait()
+}
@@ -0,0 +1,185 @@
+package goext
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ayonli/goext/clock"
+	"github.com/ayonli/goext/collections"
+)
+
+// DebounceOptions configures the debounced function created by `goext.Debounce()`.
+type DebounceOptions struct {
+	// Duration is the quiet time that must pass after the last call before the trailing call is
+	// made.
+	Duration time.Duration
+	// Leading makes the call immediately at the beginning of a series of calls.
+	Leading bool
+	// Trailing makes the call with the last argument at the end of a series of calls. If neither
+	// `Leading` nor `Trailing` is set, `Trailing` is used.
+	Trailing bool
+	// MaxWait is the maximum time the trailing call is allowed to be delayed since the beginning
+	// of a series of calls, if not set, the call is delayed as long as the calls keep coming.
+	MaxWait time.Duration
+	// ForKey keeps the state in a global registry for the given key, debounced functions created
+	// with the same key share the same state, and the trailing call is made with the handler bound
+	// to the latest call. Use `goext.RemoveDebounce()` to remove the state once it's no longer
+	// needed.
+	ForKey string
+	// Clock is used to measure the durations, default `clock.Real()`.
+	Clock clock.Clock
+}
+
+type debounceState[A any] struct {
+	mut      sync.Mutex
+	clock    clock.Clock
+	timer    clock.Timer
+	gen      int // increases every time the timer is (re)set, so that stale timers are ignored
+	started  time.Time
+	pending  bool
+	arg      A
+	handler  func(arg A)
+	leading  bool
+	trailing bool
+	duration time.Duration
+	maxWait  time.Duration
+}
+
+// Debouncer is a debounced function created by `goext.Debounce()`.
+type Debouncer[A any] struct {
+	state   *debounceState[A]
+	handler func(arg A)
+}
+
+var debounceStates = &collections.Map[string, any]{}
+
+// Debounce creates a debounced function that delays invoking the `handler` function until
+// `options.Duration` has passed since the last time it's called, so that a series of calls happen
+// in a short time are collapsed into one.
+//
+// The `handler` function is called in another goroutine for the trailing call, and in the caller's
+// goroutine for the leading call.
+func Debounce[A any](handler func(arg A), options DebounceOptions) *Debouncer[A] {
+	init := func() *debounceState[A] {
+		return &debounceState[A]{
+			clock:    clock.Or(options.Clock),
+			leading:  options.Leading,
+			trailing: options.Trailing || !options.Leading,
+			duration: options.Duration,
+			maxWait:  options.MaxWait,
+		}
+	}
+
+	var state *debounceState[A]
+
+	if options.ForKey == "" {
+		state = init()
+	} else {
+		state = (debounceStates.Use(options.ForKey, func() any {
+			return any(init())
+		})).(*debounceState[A])
+	}
+
+	return &Debouncer[A]{state: state, handler: handler}
+}
+
+// RemoveDebounce removes the state of the given key from the global registry, debounced functions
+// created with the key afterwards start with a new state. The debounced functions created before
+// keep sharing the removed state.
+func RemoveDebounce(forKey string) {
+	debounceStates.Delete(forKey)
+}
+
+// Call calls the debounced function with the given argument.
+func (debouncer *Debouncer[A]) Call(arg A) {
+	state := debouncer.state
+	state.mut.Lock()
+
+	state.handler = debouncer.handler
+	now := state.clock.Now()
+	delay := state.duration
+	var leading func(arg A)
+
+	if state.timer == nil {
+		state.started = now
+
+		if state.leading {
+			leading = state.handler
+		}
+
+		state.pending = state.trailing && !state.leading
+	} else {
+		state.timer.Stop()
+		state.pending = state.trailing
+	}
+
+	state.arg = arg
+
+	if state.maxWait > 0 {
+		delay = min(delay, state.started.Add(state.maxWait).Sub(now))
+	}
+
+	state.gen++
+	gen := state.gen
+	state.timer = state.clock.AfterFunc(delay, func() {
+		state.mut.Lock()
+
+		if state.gen != gen {
+			state.mut.Unlock()
+			return
+		}
+
+		state.flush()
+	})
+
+	state.mut.Unlock()
+
+	if leading != nil {
+		leading(arg)
+	}
+}
+
+// flush ends the current series of calls and makes the trailing call if there is one pending, the
+// caller must hold the lock, which is released by this function.
+func (state *debounceState[A]) flush() {
+	pending, handler, arg := state.pending, state.handler, state.arg
+
+	state.reset()
+	state.mut.Unlock()
+
+	if pending {
+		handler(arg)
+	}
+}
+
+// reset ends the current series of calls without making any call, the caller must hold the lock.
+func (state *debounceState[A]) reset() {
+	if state.timer != nil {
+		state.timer.Stop()
+		state.timer = nil
+	}
+
+	state.gen++
+	state.pending = false
+	state.arg = *new(A)
+}
+
+// Flush makes the pending trailing call immediately in the current goroutine, if there is one.
+func (debouncer *Debouncer[A]) Flush() {
+	debouncer.state.mut.Lock()
+	debouncer.state.flush()
+}
+
+// Cancel discards the pending trailing call, if there is one.
+func (debouncer *Debouncer[A]) Cancel() {
+	debouncer.state.mut.Lock()
+	defer debouncer.state.mut.Unlock()
+	debouncer.state.reset()
+}
+
+// Pending reports whether there is a trailing call waiting to be made.
+func (debouncer *Debouncer[A]) Pending() bool {
+	debouncer.state.mut.Lock()
+	defer debouncer.state.mut.Unlock()
+	return debouncer.state.pending
+}
@@ -0,0 +1,216 @@
+package goext_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ayonli/goext"
+	"github.com/ayonli/goext/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func ExampleDebounce() {
+	out := make(chan int)
+	fn := goext.Debounce(func(arg int) {
+		out <- arg
+	}, goext.DebounceOptions{Duration: time.Millisecond * 5})
+
+	fn.Call(1)
+	fn.Call(2)
+	fn.Call(3)
+
+	fmt.Println(<-out)
+	// Output:
+	// 3
+}
+
+func ExampleDebouncer_Flush() {
+	fn := goext.Debounce(func(arg string) {
+		fmt.Println(arg)
+	}, goext.DebounceOptions{Duration: time.Second})
+
+	fn.Call("foo")
+	fn.Call("bar")
+	fn.Flush() // no need to wait for one second
+	// Output:
+	// bar
+}
+
+type debounceRecorder[A any] struct {
+	mut   sync.Mutex
+	calls []A
+}
+
+func (recorder *debounceRecorder[A]) record(arg A) {
+	recorder.mut.Lock()
+	defer recorder.mut.Unlock()
+	recorder.calls = append(recorder.calls, arg)
+}
+
+func (recorder *debounceRecorder[A]) get() []A {
+	recorder.mut.Lock()
+	defer recorder.mut.Unlock()
+	return append([]A{}, recorder.calls...)
+}
+
+func TestDebounce(suit *testing.T) {
+	newClock := func() *clock.Fake {
+		return clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	}
+
+	suit.Run("Trailing", func(t *testing.T) {
+		fake := newClock()
+		recorder := &debounceRecorder[int]{}
+		fn := goext.Debounce(recorder.record, goext.DebounceOptions{
+			Duration: time.Millisecond * 10,
+			Clock:    fake,
+		})
+
+		fn.Call(1)
+		fake.Advance(time.Millisecond * 5)
+		fn.Call(2)
+		fake.Advance(time.Millisecond * 9)
+		assert.True(t, fn.Pending())
+		assert.Equal(t, []int{}, recorder.get())
+
+		fake.Advance(time.Millisecond * 1)
+		assert.Equal(t, []int{2}, recorder.get())
+		assert.False(t, fn.Pending())
+	})
+
+	suit.Run("Leading", func(t *testing.T) {
+		fake := newClock()
+		recorder := &debounceRecorder[int]{}
+		fn := goext.Debounce(recorder.record, goext.DebounceOptions{
+			Duration: time.Millisecond * 10,
+			Leading:  true,
+			Clock:    fake,
+		})
+
+		fn.Call(1)
+		fn.Call(2)
+		assert.Equal(t, []int{1}, recorder.get())
+		assert.False(t, fn.Pending())
+
+		fake.Advance(time.Millisecond * 10)
+		assert.Equal(t, []int{1}, recorder.get())
+
+		fn.Call(3)
+		assert.Equal(t, []int{1, 3}, recorder.get())
+	})
+
+	suit.Run("LeadingAndTrailing", func(t *testing.T) {
+		fake := newClock()
+		recorder := &debounceRecorder[int]{}
+		fn := goext.Debounce(recorder.record, goext.DebounceOptions{
+			Duration: time.Millisecond * 10,
+			Leading:  true,
+			Trailing: true,
+			Clock:    fake,
+		})
+
+		fn.Call(1)
+		assert.False(t, fn.Pending())
+		fn.Call(2)
+		fn.Call(3)
+		assert.Equal(t, []int{1}, recorder.get())
+
+		fake.Advance(time.Millisecond * 10)
+		assert.Equal(t, []int{1, 3}, recorder.get())
+
+		// a single call only triggers the leading edge
+		fn.Call(4)
+		fake.Advance(time.Millisecond * 10)
+		assert.Equal(t, []int{1, 3, 4}, recorder.get())
+	})
+
+	suit.Run("MaxWait", func(t *testing.T) {
+		fake := newClock()
+		recorder := &debounceRecorder[int]{}
+		fn := goext.Debounce(recorder.record, goext.DebounceOptions{
+			Duration: time.Millisecond * 10,
+			MaxWait:  time.Millisecond * 25,
+			Clock:    fake,
+		})
+
+		for i := 1; i <= 10; i++ {
+			fn.Call(i)
+			fake.Advance(time.Millisecond * 5)
+		}
+
+		// called every 25ms even if the calls keep coming
+		assert.Equal(t, []int{5, 10}, recorder.get())
+	})
+
+	suit.Run("Cancel", func(t *testing.T) {
+		fake := newClock()
+		recorder := &debounceRecorder[int]{}
+		fn := goext.Debounce(recorder.record, goext.DebounceOptions{
+			Duration: time.Millisecond * 5,
+			Clock:    fake,
+		})
+
+		fn.Call(1)
+		fn.Cancel()
+		assert.False(t, fn.Pending())
+
+		fake.Advance(time.Millisecond * 10)
+		assert.Equal(t, []int{}, recorder.get())
+
+		fn.Flush() // nothing to flush
+		assert.Equal(t, []int{}, recorder.get())
+	})
+
+	suit.Run("ForKey", func(t *testing.T) {
+		fake := newClock()
+		recorder := &debounceRecorder[string]{}
+		defer goext.RemoveDebounce("debounceForKey")
+		call := func(arg string) {
+			goext.Debounce(func(arg string) {
+				recorder.record("handler1: " + arg)
+			}, goext.DebounceOptions{
+				Duration: time.Millisecond * 5,
+				ForKey:   "debounceForKey",
+				Clock:    fake,
+			}).Call(arg)
+		}
+
+		call("foo")
+		call("bar")
+
+		goext.Debounce(func(arg string) {
+			recorder.record("handler2: " + arg)
+		}, goext.DebounceOptions{
+			Duration: time.Millisecond * 5,
+			ForKey:   "debounceForKey",
+			Clock:    fake,
+		}).Call("baz")
+
+		fake.Advance(time.Millisecond * 5)
+		assert.Equal(t, []string{"handler2: baz"}, recorder.get())
+	})
+
+	suit.Run("RemoveDebounce", func(t *testing.T) {
+		fake := newClock()
+		recorder := &debounceRecorder[string]{}
+		options := goext.DebounceOptions{
+			Duration: time.Millisecond * 5,
+			ForKey:   "debounceRemove",
+			Clock:    fake,
+		}
+
+		fn1 := goext.Debounce(recorder.record, options)
+		fn1.Call("foo")
+		goext.RemoveDebounce("debounceRemove")
+
+		fn2 := goext.Debounce(recorder.record, options)
+		assert.False(t, fn2.Pending()) // starts with a new state
+		fn2.Call("bar")
+
+		fake.Advance(time.Millisecond * 5)
+		assert.ElementsMatch(t, []string{"foo", "bar"}, recorder.get())
+		goext.RemoveDebounce("debounceRemove")
+	})
+}
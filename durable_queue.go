@@ -0,0 +1,449 @@
+package goext
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ayonli/goext/mapx"
+)
+
+// Codec encodes and decodes the data persisted by a durable queue.
+type Codec[T any] interface {
+	Encode(data T) ([]byte, error)
+	Decode(raw []byte) (T, error)
+}
+
+// JSONCodec is the default codec of a durable queue, it encodes data in JSON format.
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(data T) ([]byte, error) {
+	return json.Marshal(data)
+}
+
+func (JSONCodec[T]) Decode(raw []byte) (T, error) {
+	var data T
+	err := json.Unmarshal(raw, &data)
+	return data, err
+}
+
+// DurableQueueOptions configures the queue created by `goext.DurableQueue()`.
+type DurableQueueOptions[T any] struct {
+	QueueOptions
+	// Codec encodes and decodes the data persisted in the log, default `goext.JSONCodec`.
+	Codec Codec[T]
+	// CompactInterval is the interval to rewrite the log with only the unacknowledged data, default
+	// 1 minute. The log is also compacted on startup and after the queue is drained.
+	CompactInterval time.Duration
+	// Sync flushes the log to the disk after every write, which is safer against system crashes
+	// but much slower.
+	Sync bool
+	// OnError is the handler that is called when the data finally fail to be processed, it's set
+	// before the replay starts, so that it also receives the errors of the replayed data.
+	OnError func(err error)
+	// OnDeadLetter is the handler that receives the data that finally fail to be processed, along
+	// with the errors of all the attempts. Like OnError, it's set before the replay starts.
+	OnDeadLetter func(data T, errs []error)
+}
+
+// durableEntry is a line in the log, either a pushed data or an acknowledgement of it.
+type durableEntry struct {
+	Id   uint64 `json:"id"`
+	Data []byte `json:"data,omitempty"`
+	Ack  bool   `json:"ack,omitempty"`
+}
+
+type durableRecord[T any] struct {
+	id   uint64
+	data T
+}
+
+type DurableQueueImpl[T any] struct {
+	queue             IQueue[durableRecord[T]]
+	overflow          OverflowPolicy
+	path              string
+	codec             Codec[T]
+	sync              bool
+	mut               sync.Mutex // guards the log file and the unacked records
+	file              *os.File
+	fileErr           error // why the log was left closed, if not closed by the queue itself
+	lastId            uint64
+	unacked           map[uint64][]byte
+	replay            []durableRecord[T]
+	ready             chan struct{} // closed once all the replayed data have entered the buffer
+	done              chan struct{}
+	errorHandler      func(err error)
+	deadLetterHandler func(data T, errs []error)
+}
+
+func (queue *DurableQueueImpl[T]) Push(data T) error {
+	return queue.PushContext(context.Background(), data)
+}
+
+// startReplay pushes the unacknowledged data from the log into the buffer, in another goroutine
+// since they may not fit into the buffer at once.
+func (queue *DurableQueueImpl[T]) startReplay() {
+	if len(queue.replay) == 0 {
+		close(queue.ready)
+		return
+	}
+
+	go func() {
+		for _, record := range queue.replay {
+			if err := queue.queue.Push(record); err != nil {
+				break
+			}
+		}
+
+		queue.replay = nil
+		close(queue.ready)
+	}()
+}
+
+// TryPush returns false while the unacknowledged data are still being replayed from the log, since
+// they are pushed into the buffer first.
+func (queue *DurableQueueImpl[T]) TryPush(data T) bool {
+	select {
+	case <-queue.ready:
+	default:
+		return false
+	}
+
+	record, err := queue.append(data)
+
+	if err != nil {
+		return false
+	} else if !queue.queue.TryPush(record) {
+		// the data is not accepted, it should not be replayed
+		queue.ack(record.id)
+		return false
+	}
+
+	return true
+}
+
+func (queue *DurableQueueImpl[T]) PushContext(ctx context.Context, data T) error {
+	select {
+	case <-queue.ready:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	record, err := queue.append(data)
+
+	if err != nil {
+		return err
+	} else if queue.overflow == OverflowError {
+		if !queue.queue.TryPush(record) {
+			queue.ack(record.id)
+			return ErrQueueFull
+		}
+	} else if err = queue.queue.PushContext(ctx, record); err != nil {
+		queue.ack(record.id)
+		return err
+	}
+
+	return nil
+}
+
+// Close closes the queue, data replayed from the log are treated as already pushed, so Close waits
+// until all of them enter the buffer.
+func (queue *DurableQueueImpl[T]) Close() {
+	<-queue.ready
+	queue.queue.Close()
+}
+
+func (queue *DurableQueueImpl[T]) Drain(ctx context.Context) error {
+	queue.Close()
+
+	select {
+	case <-queue.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (queue *DurableQueueImpl[T]) Done() <-chan struct{} {
+	return queue.done
+}
+
+func (queue *DurableQueueImpl[T]) Stats() QueueStats {
+	return queue.queue.Stats()
+}
+
+func (queue *DurableQueueImpl[T]) OnError(handler func(err error)) {
+	queue.errorHandler = handler
+}
+
+func (queue *DurableQueueImpl[T]) OnDeadLetter(handler func(data T, errs []error)) {
+	queue.deadLetterHandler = handler
+}
+
+func (queue *DurableQueueImpl[T]) emitError(err error) {
+	if queue.errorHandler != nil {
+		queue.errorHandler(err)
+	}
+}
+
+// write writes an entry to the log, the caller must hold the lock.
+func (queue *DurableQueueImpl[T]) write(entry durableEntry) error {
+	line, err := json.Marshal(entry)
+
+	if err != nil {
+		return err
+	} else if _, err = queue.file.Write(append(line, '\n')); err != nil {
+		return err
+	} else if queue.sync {
+		return queue.file.Sync()
+	}
+
+	return nil
+}
+
+func (queue *DurableQueueImpl[T]) append(data T) (durableRecord[T], error) {
+	raw, err := queue.codec.Encode(data)
+
+	if err != nil {
+		return durableRecord[T]{}, err
+	}
+
+	queue.mut.Lock()
+	defer queue.mut.Unlock()
+
+	if queue.file == nil {
+		if queue.fileErr != nil {
+			return durableRecord[T]{}, queue.fileErr
+		}
+
+		return durableRecord[T]{}, ErrQueueClosed
+	}
+
+	id := queue.lastId + 1
+
+	if err := queue.write(durableEntry{Id: id, Data: raw}); err != nil {
+		return durableRecord[T]{}, err
+	}
+
+	queue.lastId = id
+	queue.unacked[id] = raw
+	return durableRecord[T]{id: id, data: data}, nil
+}
+
+func (queue *DurableQueueImpl[T]) ack(id uint64) {
+	queue.mut.Lock()
+
+	if _, ok := queue.unacked[id]; !ok || queue.file == nil {
+		queue.mut.Unlock()
+		return
+	}
+
+	delete(queue.unacked, id)
+	err := queue.write(durableEntry{Id: id, Ack: true})
+	queue.mut.Unlock()
+
+	if err != nil {
+		queue.emitError(err)
+	}
+}
+
+// compact rewrites the log with only the unacknowledged data, the caller must hold the lock.
+func (queue *DurableQueueImpl[T]) compact() error {
+	tmpPath := queue.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	ids := mapx.Keys(queue.unacked)
+	slices.Sort(ids)
+
+	for _, id := range ids {
+		line, _ := json.Marshal(durableEntry{Id: id, Data: queue.unacked[id]})
+
+		if _, err = writer.Write(append(line, '\n')); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		err = writer.Flush()
+	}
+
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if _err := file.Close(); err == nil {
+		err = _err
+	}
+
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	} else if err = os.Rename(tmpPath, queue.path); err != nil {
+		return err
+	}
+
+	if queue.file != nil {
+		queue.file.Close()
+	}
+
+	queue.file, err = os.OpenFile(queue.path, os.O_APPEND|os.O_WRONLY, 0644)
+
+	if err != nil {
+		// keep the error so that the pushes report it rather than `ErrQueueClosed`
+		queue.fileErr = err
+	}
+
+	return err
+}
+
+// load reads the log and restores the unacknowledged data.
+func (queue *DurableQueueImpl[T]) load() error {
+	file, err := os.Open(queue.path)
+
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<30)
+
+	for scanner.Scan() {
+		var entry durableEntry
+
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue // the last line may be incomplete if the process crashed while writing
+		}
+
+		queue.lastId = max(queue.lastId, entry.Id)
+
+		if entry.Ack {
+			delete(queue.unacked, entry.Id)
+		} else {
+			queue.unacked[entry.Id] = entry.Data
+		}
+	}
+
+	return scanner.Err()
+}
+
+// DurableQueue is like `goext.QueueWithOptions()`, except the data pushed into the queue are
+// persisted in an append-only log at the given `path`, and acknowledged after the `handler`
+// function succeeds. Unacknowledged data in the log are replayed on startup, before any new data,
+// set `options.OnError` and `options.OnDeadLetter` to handle the failures of the replayed data.
+//
+// Data that finally fail to be processed are acknowledged only if a dead-letter handler is set,
+// otherwise, they are replayed the next time the queue is created.
+//
+// Since the data are persisted before entering the buffer, `goext.OverflowDropNewest` and
+// `goext.OverflowDropOldest` are not supported and act like `goext.OverflowBlock`.
+func DurableQueue[T any](
+	handler func(data T),
+	path string,
+	options DurableQueueOptions[T],
+) (IQueue[T], error) {
+	queue := &DurableQueueImpl[T]{
+		overflow:          options.Overflow,
+		path:              path,
+		codec:             options.Codec,
+		sync:              options.Sync,
+		unacked:           map[uint64][]byte{},
+		ready:             make(chan struct{}),
+		done:              make(chan struct{}),
+		errorHandler:      options.OnError,
+		deadLetterHandler: options.OnDeadLetter,
+	}
+
+	if queue.codec == nil {
+		queue.codec = JSONCodec[T]{}
+	}
+
+	if err := queue.load(); err != nil {
+		return nil, err
+	} else if err := queue.compact(); err != nil {
+		return nil, err
+	}
+
+	ids := mapx.Keys(queue.unacked)
+	slices.Sort(ids)
+
+	for _, id := range ids {
+		data, err := queue.codec.Decode(queue.unacked[id])
+
+		if err != nil {
+			queue.file.Close()
+			return nil, err
+		}
+
+		queue.replay = append(queue.replay, durableRecord[T]{id: id, data: data})
+	}
+
+	// the overflow policy is handled by the durable queue itself, so that replayed data always
+	// enter the buffer
+	queueOptions := options.QueueOptions
+	queueOptions.Overflow = OverflowBlock
+
+	queue.queue = QueueWithOptions(func(record durableRecord[T]) {
+		handler(record.data)
+		queue.ack(record.id)
+	}, queueOptions)
+	queue.queue.OnError(func(err error) {
+		queue.emitError(err)
+	})
+	queue.queue.OnDeadLetter(func(record durableRecord[T], errs []error) {
+		if queue.deadLetterHandler != nil {
+			queue.deadLetterHandler(record.data, errs)
+			queue.ack(record.id)
+		}
+	})
+
+	go func() {
+		interval := options.CompactInterval
+
+		if interval <= 0 {
+			interval = time.Minute
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				queue.mut.Lock()
+
+				if err := queue.compact(); err != nil {
+					queue.emitError(err)
+				}
+
+				queue.mut.Unlock()
+			case <-queue.queue.Done():
+				queue.mut.Lock()
+
+				if err := queue.compact(); err != nil {
+					queue.emitError(err)
+				}
+
+				queue.file.Close()
+				queue.file = nil
+				queue.mut.Unlock()
+				close(queue.done)
+				return
+			}
+		}
+	}()
+
+	queue.startReplay()
+	return queue, nil
+}
@@ -0,0 +1,240 @@
+package goext_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ayonli/goext"
+	"github.com/stretchr/testify/assert"
+)
+
+func ExampleDurableQueue() {
+	dir, _ := os.MkdirTemp("", "goext")
+	defer os.RemoveAll(dir)
+
+	queue, err := goext.DurableQueue(func(job string) {
+		fmt.Println("processing", job)
+	}, filepath.Join(dir, "jobs.log"), goext.DurableQueueOptions[string]{})
+
+	if err != nil {
+		panic(err)
+	}
+
+	queue.Push("foo")
+	queue.Push("bar")
+	queue.Drain(context.Background())
+	// Output:
+	// processing foo
+	// processing bar
+}
+
+type intCodec struct{}
+
+func (intCodec) Encode(data int) ([]byte, error) {
+	return []byte(strconv.Itoa(data)), nil
+}
+
+func (intCodec) Decode(raw []byte) (int, error) {
+	return strconv.Atoi(string(raw))
+}
+
+func TestDurableQueue(t *testing.T) {
+	t.Run("replay", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "queue.log")
+		release := make(chan struct{})
+		defer close(release)
+
+		queue1, err := goext.DurableQueue(func(num int) {
+			if num > 2 {
+				<-release // simulate that the process exits before these data are processed
+			}
+		}, path, goext.DurableQueueOptions[int]{
+			QueueOptions: goext.QueueOptions{BufferSize: 10},
+		})
+		assert.Nil(t, err)
+
+		for i := 1; i <= 5; i++ {
+			assert.Nil(t, queue1.Push(i))
+		}
+
+		for queue1.Stats().Processed < 2 {
+			time.Sleep(time.Millisecond)
+		}
+
+		queue1.Close()
+
+		results := []int{}
+		queue2, err := goext.DurableQueue(func(num int) {
+			results = append(results, num)
+		}, path, goext.DurableQueueOptions[int]{})
+		assert.Nil(t, err)
+
+		queue2.Push(6)
+		queue2.Drain(context.Background())
+		assert.Equal(t, []int{3, 4, 5, 6}, results)
+
+		info, _ := os.Stat(path)
+		assert.Equal(t, int64(0), info.Size()) // compacted after drained
+	})
+
+	t.Run("replayOnStartup", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "queue.log")
+		queue1, _ := goext.DurableQueue(func(num int) {
+			select {} // simulate that the process exits before any data is processed
+		}, path, goext.DurableQueueOptions[int]{
+			QueueOptions: goext.QueueOptions{BufferSize: 10},
+		})
+
+		for i := 1; i <= 3; i++ {
+			queue1.Push(i)
+		}
+
+		queue1.Close()
+
+		processed := make(chan int, 3)
+		queue2, _ := goext.DurableQueue(func(num int) {
+			processed <- num
+		}, path, goext.DurableQueueOptions[int]{})
+
+		// the data are replayed without any new data being pushed
+		assert.Equal(t, []int{1, 2, 3}, []int{<-processed, <-processed, <-processed})
+
+		assert.Nil(t, queue2.Drain(context.Background()))
+		assert.Equal(t, goext.QueueStats{Processed: 3}, queue2.Stats())
+
+		info, _ := os.Stat(path)
+		assert.Equal(t, int64(0), info.Size())
+	})
+
+	t.Run("TryPushWhileReplaying", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "queue.log")
+		queue1, _ := goext.DurableQueue(func(num int) {
+			select {} // simulate that the process exits before any data is processed
+		}, path, goext.DurableQueueOptions[int]{
+			QueueOptions: goext.QueueOptions{BufferSize: 10},
+		})
+
+		for i := 1; i <= 3; i++ {
+			queue1.Push(i)
+		}
+
+		queue1.Close()
+
+		results := []int{}
+		release := make(chan struct{})
+		queue2, _ := goext.DurableQueue(func(num int) {
+			<-release
+			results = append(results, num)
+		}, path, goext.DurableQueueOptions[int]{
+			QueueOptions: goext.QueueOptions{BufferSize: 1},
+		})
+
+		// the replayed data don't fit into the buffer until the handler proceeds
+		assert.False(t, queue2.TryPush(4))
+
+		close(release)
+		queue2.Drain(context.Background())
+		assert.Equal(t, []int{1, 2, 3}, results)
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "queue.log")
+		queue1, _ := goext.DurableQueue(func(num int) {
+			if num%2 == 0 {
+				panic("something went wrong")
+			}
+		}, path, goext.DurableQueueOptions[int]{})
+
+		for i := 1; i <= 4; i++ {
+			queue1.Push(i)
+		}
+
+		queue1.Drain(context.Background())
+		assert.Equal(t, goext.QueueStats{Processed: 2, Failed: 2}, queue1.Stats())
+
+		// failed data are replayed since no dead-letter handler is set
+		results := []int{}
+		deadLetters := []int{}
+		queue2, _ := goext.DurableQueue(func(num int) {
+			results = append(results, num)
+			panic("something went wrong")
+		}, path, goext.DurableQueueOptions[int]{
+			OnDeadLetter: func(num int, errs []error) {
+				deadLetters = append(deadLetters, num)
+			},
+		})
+
+		queue2.Drain(context.Background())
+		assert.Equal(t, []int{2, 4}, results)
+		assert.Equal(t, []int{2, 4}, deadLetters)
+
+		// dead-lettered data are acknowledged
+		results = []int{}
+		queue3, _ := goext.DurableQueue(func(num int) {
+			results = append(results, num)
+		}, path, goext.DurableQueueOptions[int]{})
+
+		queue3.Drain(context.Background())
+		assert.Equal(t, []int{}, results)
+	})
+
+	t.Run("Codec", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "queue.log")
+		block := make(chan struct{})
+		queue, _ := goext.DurableQueue(func(num int) {
+			<-block
+		}, path, goext.DurableQueueOptions[int]{
+			QueueOptions: goext.QueueOptions{BufferSize: 1},
+			Codec:        intCodec{},
+		})
+
+		queue.Push(1)
+		queue.Push(2)
+
+		content, _ := os.ReadFile(path)
+		assert.Contains(t, string(content), fmt.Sprintf("%q", "MQ==")) // base64 of "1"
+
+		close(block)
+		queue.Drain(context.Background())
+	})
+
+	t.Run("OverflowError", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "queue.log")
+		started := make(chan struct{})
+		release := make(chan struct{})
+		results := []int{}
+		queue, _ := goext.DurableQueue(func(num int) {
+			if num == 1 {
+				close(started)
+				<-release
+			}
+
+			results = append(results, num)
+		}, path, goext.DurableQueueOptions[int]{
+			QueueOptions: goext.QueueOptions{BufferSize: 1, Overflow: goext.OverflowError},
+		})
+
+		queue.Push(1)
+		<-started
+		assert.Nil(t, queue.Push(2))
+		assert.Equal(t, goext.ErrQueueFull, queue.Push(3))
+
+		close(release)
+		queue.Drain(context.Background())
+		assert.Equal(t, []int{1, 2}, results)
+		assert.Equal(t, goext.ErrQueueClosed, queue.Push(4))
+		assert.False(t, queue.TryPush(4))
+	})
+
+	t.Run("invalidPath", func(t *testing.T) {
+		_, err := goext.DurableQueue(func(num int) {}, filepath.Join(t.TempDir(), "foo", "queue.log"),
+			goext.DurableQueueOptions[int]{})
+		assert.True(t, errors.Is(err, os.ErrNotExist))
+	})
+}
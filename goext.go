@@ -3,6 +3,9 @@ package goext
 import (
 	"errors"
 	"fmt"
+	"io"
+	"runtime/debug"
+	"strings"
 )
 
 // ReadAll reads all values from the channel at once.
@@ -36,18 +39,86 @@ func Ok[R any](res R, err error) R {
 	}
 }
 
+// PanicError is the error returned by `goext.Try()` when the function panics, it keeps the
+// recovered value and the stack of the goroutine where the panic happened.
+//
+// PanicError has the same message as the wrapped error, and formatting it with `%+v` prints the
+// stack as well.
+type PanicError struct {
+	// Value is the value passed to `panic()`.
+	Value any
+	// Stack is the stack trace of the goroutine at the panic site.
+	Stack []byte
+	err   error
+}
+
+// NewPanicError creates a PanicError from the value recovered from a panic, it should be called
+// in the deferred function that recovers, so that the stack includes the panic site.
+//
+// If the value is (or wraps) a PanicError already, for example, when a panic is caught and thrown
+// again, the value itself is returned so that the original stack is kept.
+func NewPanicError(value any) error {
+	var err error
+
+	if _err, ok := value.(error); ok {
+		var panicErr *PanicError
+
+		if errors.As(_err, &panicErr) {
+			return _err
+		}
+
+		err = _err
+	} else if str, ok := value.(string); ok {
+		err = errors.New(str)
+	} else {
+		err = errors.New(fmt.Sprint(value))
+	}
+
+	return &PanicError{Value: value, Stack: panicStack(), err: err}
+}
+
+// panicStack returns the stack of the current goroutine with the frames of recovering removed.
+func panicStack() []byte {
+	lines := strings.Split(string(debug.Stack()), "\n")
+
+	for i, line := range lines {
+		if strings.HasPrefix(line, "panic(") && i+2 <= len(lines) {
+			// keep the goroutine header, skip the `panic()` call and its file line
+			return []byte(strings.Join(append(lines[:1:1], lines[i+2:]...), "\n"))
+		}
+	}
+
+	return []byte(strings.Join(lines, "\n"))
+}
+
+func (err *PanicError) Error() string {
+	return err.err.Error()
+}
+
+func (err *PanicError) Unwrap() error {
+	return err.err
+}
+
+func (err *PanicError) Format(f fmt.State, verb rune) {
+	switch {
+	case verb == 'v' && f.Flag('+'):
+		fmt.Fprintf(f, "%+v\n\n%s", err.err, err.Stack)
+	case verb == 'q':
+		fmt.Fprintf(f, "%q", err.Error())
+	default:
+		io.WriteString(f, err.Error())
+	}
+}
+
 // Try runs a function in a safe context where if it or what's inside it panics, the panic reason
 // can be caught and returned as a normal error.
+//
+// The returned error is a `*goext.PanicError` which keeps the recovered value and the stack of
+// the panic site, use `errors.Is()` or `errors.As()` to check the original error.
 func Try[R any](fn func() R) (res R, err error) {
 	defer func() {
 		if re := recover(); re != nil {
-			if _err, ok := re.(error); ok {
-				err = _err
-			} else if str, ok := re.(string); ok {
-				err = errors.New(str)
-			} else {
-				err = errors.New(fmt.Sprint(re))
-			}
+			err = NewPanicError(re)
 		}
 	}()
 
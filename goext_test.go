@@ -1,6 +1,8 @@
 package goext_test
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/ayonli/goext"
@@ -26,3 +28,52 @@ func TestWrap(t *testing.T) {
 	assert.Equal(t, "everything looks fine", res)
 	assert.Nil(t, err)
 }
+
+func panicSite() int {
+	panic("something went wrong")
+}
+
+func TestTry(t *testing.T) {
+	t.Run("PanicError", func(t *testing.T) {
+		_, err := goext.Try(panicSite)
+
+		var panicErr *goext.PanicError
+		assert.True(t, errors.As(err, &panicErr))
+		assert.Equal(t, "something went wrong", panicErr.Value)
+		assert.Equal(t, "something went wrong", err.Error())
+		assert.Equal(t, "something went wrong", fmt.Sprint(err))
+		assert.Contains(t, string(panicErr.Stack), "goext_test.panicSite")
+		assert.NotContains(t, string(panicErr.Stack), "runtime/debug.Stack")
+		assert.Contains(t, fmt.Sprintf("%+v", err), "goext_test.panicSite")
+	})
+
+	t.Run("wrapError", func(t *testing.T) {
+		errFoo := errors.New("foo")
+		_, err := goext.Try(func() int {
+			panic(errFoo)
+		})
+
+		assert.ErrorIs(t, err, errFoo)
+		assert.Equal(t, errFoo, errors.Unwrap(err))
+	})
+
+	t.Run("nonError", func(t *testing.T) {
+		_, err := goext.Try(func() int {
+			panic(123)
+		})
+
+		var panicErr *goext.PanicError
+		assert.True(t, errors.As(err, &panicErr))
+		assert.Equal(t, 123, panicErr.Value)
+		assert.Equal(t, "123", err.Error())
+	})
+
+	t.Run("rethrow", func(t *testing.T) {
+		_, err1 := goext.Try(panicSite)
+		_, err2 := goext.Try(func() int {
+			panic(err1)
+		})
+
+		assert.Same(t, err1, err2) // the original stack is kept
+	})
+}
@@ -0,0 +1,191 @@
+package goext
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ayonli/goext/clock"
+)
+
+// MemoizeOptions configures the memoized function created by `goext.Memoize()`.
+type MemoizeOptions[A any] struct {
+	// Key derives a cache key from the argument, default `fmt.Sprint(arg)`.
+	Key func(arg A) string
+	// MaxEntries is the maximum number of results kept in the cache, once exceeded, the least
+	// recently used one is evicted. By default, the cache is unbounded.
+	MaxEntries int
+	// TTL is how long a result stays in the cache after it's produced. By default, results never
+	// expire.
+	TTL time.Duration
+	// Clock is used to check the expiration of the results, default `clock.Real()`.
+	Clock clock.Clock
+}
+
+type memoEntry[R any] struct {
+	key     string
+	value   R
+	expires time.Time     // zero if the entry never expires
+	expiry  *list.Element // the element in the expiring list, nil if the entry never expires
+}
+
+// memoCall is an in-flight invocation of the handler function shared by concurrent calls.
+type memoCall[R any] struct {
+	done  chan struct{}
+	value R
+	err   error
+}
+
+type memoCache[R any] struct {
+	mut      sync.Mutex
+	entries  map[string]*list.Element
+	order    *list.List // most recently used at the front
+	expiring *list.List // entries with a TTL, the soonest to expire at the front
+	inflight map[string]*memoCall[R]
+	clock    clock.Clock
+}
+
+// remove deletes the entry from the cache, the caller must hold the lock.
+func (cache *memoCache[R]) remove(elem *list.Element) {
+	entry := elem.Value.(*memoEntry[R])
+	cache.order.Remove(elem)
+	delete(cache.entries, entry.key)
+
+	if entry.expiry != nil {
+		cache.expiring.Remove(entry.expiry)
+	}
+}
+
+// get returns the cached value for the key, the caller must hold the lock.
+func (cache *memoCache[R]) get(key string) (R, bool) {
+	elem, ok := cache.entries[key]
+
+	if !ok {
+		return *new(R), false
+	}
+
+	entry := elem.Value.(*memoEntry[R])
+
+	if !entry.expires.IsZero() && !entry.expires.After(cache.clock.Now()) {
+		cache.remove(elem)
+		return *new(R), false
+	}
+
+	cache.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+// set stores the value for the key and evicts the expired and the least recently used entries, the
+// caller must hold the lock.
+func (cache *memoCache[R]) set(key string, value R, ttl time.Duration, maxEntries int) {
+	now := cache.clock.Now()
+
+	// all entries share the same TTL, so they expire in the order they are stored
+	for front := cache.expiring.Front(); front != nil; front = cache.expiring.Front() {
+		elem := front.Value.(*list.Element)
+
+		if elem.Value.(*memoEntry[R]).expires.After(now) {
+			break
+		}
+
+		cache.remove(elem)
+	}
+
+	if elem, ok := cache.entries[key]; ok {
+		cache.remove(elem)
+	}
+
+	entry := &memoEntry[R]{key: key, value: value}
+	elem := cache.order.PushFront(entry)
+	cache.entries[key] = elem
+
+	if ttl > 0 {
+		entry.expires = now.Add(ttl)
+		entry.expiry = cache.expiring.PushBack(elem)
+	}
+
+	for maxEntries > 0 && cache.order.Len() > maxEntries {
+		cache.remove(cache.order.Back())
+	}
+}
+
+// Memoize creates a function that caches the results of the `handler` function per argument key,
+// so that subsequent calls with the same key return the cached result without invoking the
+// `handler` function again.
+//
+// Concurrent calls with the same key share a single invocation of the `handler` function. Only
+// successful results are cached, if the invocation fails, all the calls waiting for it receive the
+// error, and the next call invokes the `handler` function again.
+//
+// The cache can be bounded by `options.MaxEntries` with least-recently-used eviction, and results
+// can expire after `options.TTL`, expired results are also evicted when new ones are stored, so
+// they don't pile up in an unbounded cache.
+func Memoize[A any, R any, Fn func(arg A) (R, error)](
+	handler Fn,
+	options MemoizeOptions[A],
+) Fn {
+	cache := &memoCache[R]{
+		entries:  map[string]*list.Element{},
+		order:    list.New(),
+		expiring: list.New(),
+		inflight: map[string]*memoCall[R]{},
+		clock:    clock.Or(options.Clock),
+	}
+
+	return func(arg A) (R, error) {
+		var key string
+
+		if options.Key != nil {
+			key = options.Key(arg)
+		} else {
+			key = fmt.Sprint(arg)
+		}
+
+		cache.mut.Lock()
+
+		if value, ok := cache.get(key); ok {
+			cache.mut.Unlock()
+			return value, nil
+		} else if call, ok := cache.inflight[key]; ok {
+			cache.mut.Unlock()
+			<-call.done
+			return call.value, call.err
+		}
+
+		call := &memoCall[R]{done: make(chan struct{})}
+		cache.inflight[key] = call
+		cache.mut.Unlock()
+
+		settled := false
+		defer func() {
+			if settled {
+				return
+			}
+
+			// the handler panicked, release the waiting calls before the panic propagates
+			re := recover()
+			call.err = NewPanicError(re)
+			cache.mut.Lock()
+			delete(cache.inflight, key)
+			cache.mut.Unlock()
+			close(call.done)
+			panic(re)
+		}()
+
+		call.value, call.err = handler(arg)
+		settled = true
+
+		cache.mut.Lock()
+		delete(cache.inflight, key)
+
+		if call.err == nil {
+			cache.set(key, call.value, options.TTL, options.MaxEntries)
+		}
+
+		cache.mut.Unlock()
+		close(call.done)
+
+		return call.value, call.err
+	}
+}
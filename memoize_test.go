@@ -0,0 +1,191 @@
+package goext_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ayonli/goext"
+	"github.com/ayonli/goext/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func ExampleMemoize() {
+	square := goext.Memoize(func(n int) (int, error) {
+		fmt.Println("computing", n)
+		return n * n, nil
+	}, goext.MemoizeOptions[int]{MaxEntries: 100})
+
+	fmt.Println(square(3))
+	fmt.Println(square(3))
+	fmt.Println(square(4))
+	// Output:
+	// computing 3
+	// 9 <nil>
+	// 9 <nil>
+	// computing 4
+	// 16 <nil>
+}
+
+func TestMemoize(suit *testing.T) {
+	suit.Run("MaxEntries", func(t *testing.T) {
+		calls := []int{}
+		fn := goext.Memoize(func(n int) (int, error) {
+			calls = append(calls, n)
+			return n, nil
+		}, goext.MemoizeOptions[int]{MaxEntries: 2})
+
+		fn(1)
+		fn(2)
+		fn(1) // 1 is used recently, so 2 is evicted next
+		fn(3)
+		fn(1)
+		fn(2)
+
+		assert.Equal(t, []int{1, 2, 3, 2}, calls)
+	})
+
+	suit.Run("TTL", func(t *testing.T) {
+		calls := 0
+		fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		fn := goext.Memoize(func(n int) (int, error) {
+			calls++
+			return n, nil
+		}, goext.MemoizeOptions[int]{TTL: time.Millisecond * 10, Clock: fake})
+
+		fn(1)
+		fake.Advance(time.Millisecond * 5)
+		fn(1)
+		fn(2)
+		assert.Equal(t, 2, calls)
+
+		fake.Advance(time.Millisecond * 5)
+		fn(1)
+		fn(2) // stored later, so not expired yet
+		assert.Equal(t, 3, calls)
+	})
+
+	suit.Run("Key", func(t *testing.T) {
+		type user struct {
+			Id   int
+			Name string
+		}
+
+		calls := 0
+		fn := goext.Memoize(func(u user) (string, error) {
+			calls++
+			return u.Name, nil
+		}, goext.MemoizeOptions[user]{
+			Key: func(u user) string { return fmt.Sprint(u.Id) },
+		})
+
+		name1, _ := fn(user{Id: 1, Name: "A-yon"})
+		name2, _ := fn(user{Id: 1, Name: "Ayon"})
+		assert.Equal(t, "A-yon", name1)
+		assert.Equal(t, "A-yon", name2)
+		assert.Equal(t, 1, calls)
+	})
+
+	suit.Run("error", func(t *testing.T) {
+		calls := 0
+		fn := goext.Memoize(func(n int) (int, error) {
+			calls++
+
+			if calls == 1 {
+				return 0, errors.New("something went wrong")
+			}
+
+			return n, nil
+		}, goext.MemoizeOptions[int]{})
+
+		_, err := fn(1)
+		assert.EqualError(t, err, "something went wrong")
+
+		// errors are not cached
+		res, err := fn(1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, res)
+		assert.Equal(t, 2, calls)
+	})
+
+	suit.Run("single-flight", func(t *testing.T) {
+		calls := int32(0)
+		release := make(chan struct{})
+		fn := goext.Memoize(func(n int) (int, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return n * 2, nil
+		}, goext.MemoizeOptions[int]{})
+
+		wg := sync.WaitGroup{}
+		results := make([]int, 10)
+
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i], _ = fn(5)
+			}(i)
+		}
+
+		time.Sleep(time.Millisecond * 10)
+		close(release)
+		wg.Wait()
+
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+		for _, res := range results {
+			assert.Equal(t, 10, res)
+		}
+	})
+
+	suit.Run("panic", func(t *testing.T) {
+		started := make(chan struct{})
+		waiting := make(chan struct{})
+		release := make(chan struct{})
+		fn := goext.Memoize(func(n int) (int, error) {
+			close(started)
+			<-release
+			panic("something went wrong")
+		}, goext.MemoizeOptions[int]{
+			Key: func(n int) string {
+				select {
+				case <-started:
+					close(waiting) // the second call is about to wait for the first one
+				default:
+				}
+
+				return fmt.Sprint(n)
+			},
+		})
+
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			_, err := goext.Try(func() error {
+				_, err := fn(1)
+				return err
+			})
+			assert.NotNil(t, err)
+		}()
+
+		<-started
+
+		go func() {
+			<-waiting
+			close(release)
+		}()
+
+		// the waiting call receives the panic as an error
+		_, err := fn(1)
+		<-done
+
+		var panicErr *goext.PanicError
+		assert.ErrorAs(t, err, &panicErr)
+		assert.Equal(t, "something went wrong", panicErr.Value)
+	})
+}
@@ -0,0 +1,142 @@
+package goext
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+)
+
+// PartitionError is reported to the error handler of a partitioned queue, it carries the key of the
+// data that failed.
+type PartitionError struct {
+	Key string
+	Err error
+}
+
+func (err *PartitionError) Error() string {
+	return fmt.Sprintf("key %q: %s", err.Key, err.Err.Error())
+}
+
+func (err *PartitionError) Unwrap() error {
+	return err.Err
+}
+
+type PartitionedQueueImpl[T any] struct {
+	partitions []IQueue[T]
+	key        func(data T) string
+	done       chan struct{}
+}
+
+func (queue *PartitionedQueueImpl[T]) partition(data T) IQueue[T] {
+	hash := fnv.New32a()
+	hash.Write([]byte(queue.key(data)))
+	return queue.partitions[hash.Sum32()%uint32(len(queue.partitions))]
+}
+
+func (queue *PartitionedQueueImpl[T]) Push(data T) error {
+	return queue.partition(data).Push(data)
+}
+
+func (queue *PartitionedQueueImpl[T]) TryPush(data T) bool {
+	return queue.partition(data).TryPush(data)
+}
+
+func (queue *PartitionedQueueImpl[T]) PushContext(ctx context.Context, data T) error {
+	return queue.partition(data).PushContext(ctx, data)
+}
+
+func (queue *PartitionedQueueImpl[T]) Close() {
+	for _, partition := range queue.partitions {
+		partition.Close()
+	}
+}
+
+func (queue *PartitionedQueueImpl[T]) Drain(ctx context.Context) error {
+	queue.Close()
+
+	select {
+	case <-queue.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (queue *PartitionedQueueImpl[T]) Done() <-chan struct{} {
+	return queue.done
+}
+
+func (queue *PartitionedQueueImpl[T]) Stats() QueueStats {
+	stats := QueueStats{}
+
+	for _, partition := range queue.partitions {
+		_stats := partition.Stats()
+		stats.Processed += _stats.Processed
+		stats.Failed += _stats.Failed
+		stats.Pending += _stats.Pending
+		stats.Dropped += _stats.Dropped
+	}
+
+	return stats
+}
+
+func (queue *PartitionedQueueImpl[T]) OnError(handler func(err error)) {
+	for _, partition := range queue.partitions {
+		partition.OnError(handler)
+	}
+}
+
+func (queue *PartitionedQueueImpl[T]) OnDeadLetter(handler func(data T, errs []error)) {
+	for _, partition := range queue.partitions {
+		partition.OnDeadLetter(handler)
+	}
+}
+
+// PartitionedQueue processes data by the given `handler` function, data of the same key (returned
+// by the `key` function) are processed strictly in the order they are pushed, while data of
+// different keys may be processed in parallel.
+//
+// `options.Concurrency` sets the number of partitions, each partition is backed by one worker, and
+// each key is always assigned to the same partition. `options.BufferSize` and `options.Overflow`
+// apply to each partition respectively.
+//
+// When the `handler` function panics, the error handler receives a `*goext.PartitionError` that
+// carries the key of the failed data.
+func PartitionedQueue[T any](
+	handler func(data T),
+	key func(data T) string,
+	options QueueOptions,
+) IQueue[T] {
+	concurrency := max(options.Concurrency, 1)
+	queue := &PartitionedQueueImpl[T]{
+		partitions: make([]IQueue[T], concurrency),
+		key:        key,
+		done:       make(chan struct{}),
+	}
+
+	partitionOptions := options
+	partitionOptions.Concurrency = 1
+
+	for i := range queue.partitions {
+		queue.partitions[i] = QueueWithOptions(func(data T) {
+			_, err := Try(func() int {
+				handler(data)
+				return 0
+			})
+
+			if err != nil {
+				panic(&PartitionError{Key: key(data), Err: err})
+			}
+		}, partitionOptions)
+	}
+
+	go func() {
+		for _, partition := range queue.partitions {
+			<-partition.Done()
+		}
+
+		close(queue.done)
+	}()
+
+	return queue
+}
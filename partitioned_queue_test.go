@@ -0,0 +1,121 @@
+package goext_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ayonli/goext"
+	"github.com/stretchr/testify/assert"
+)
+
+func ExamplePartitionedQueue() {
+	mut := sync.Mutex{}
+	orders := map[string][]string{}
+	queue := goext.PartitionedQueue(func(event string) {
+		user, action, _ := strings.Cut(event, ":")
+
+		mut.Lock()
+		orders[user] = append(orders[user], action)
+		mut.Unlock()
+	}, func(event string) string {
+		user, _, _ := strings.Cut(event, ":")
+		return user
+	}, goext.QueueOptions{Concurrency: 4, BufferSize: 10})
+
+	for _, event := range []string{
+		"alice:login", "bob:login", "alice:buy", "bob:logout", "alice:logout",
+	} {
+		queue.Push(event)
+	}
+
+	queue.Drain(context.Background())
+
+	fmt.Println(orders["alice"])
+	fmt.Println(orders["bob"])
+	// Output:
+	// [login buy logout]
+	// [login logout]
+}
+
+func TestPartitionedQueue(t *testing.T) {
+	t.Run("order", func(t *testing.T) {
+		wg := sync.WaitGroup{}
+		mut := sync.Mutex{}
+		results := map[int][]int{}
+		queue := goext.PartitionedQueue(func(num int) {
+			defer wg.Done()
+			mut.Lock()
+			results[num%5] = append(results[num%5], num)
+			mut.Unlock()
+		}, func(num int) string {
+			return fmt.Sprint(num % 5)
+		}, goext.QueueOptions{Concurrency: 3, BufferSize: 100})
+
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			queue.Push(i)
+		}
+
+		wg.Wait()
+		queue.Close()
+
+		for key, nums := range results {
+			assert.Equal(t, 20, len(nums))
+
+			for i, num := range nums {
+				assert.Equal(t, key+i*5, num)
+			}
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		out := make(chan error)
+		queue := goext.PartitionedQueue(func(str string) {
+			panic(errors.New("something went wrong"))
+		}, func(str string) string {
+			return str
+		}, goext.QueueOptions{Concurrency: 2})
+		defer queue.Close()
+
+		queue.OnError(func(err error) {
+			out <- err
+		})
+
+		queue.Push("foo")
+		err := <-out
+
+		var partitionErr *goext.PartitionError
+		assert.True(t, errors.As(err, &partitionErr))
+		assert.Equal(t, "foo", partitionErr.Key)
+		assert.Equal(t, "something went wrong", partitionErr.Err.Error())
+		assert.Equal(t, `key "foo": something went wrong`, err.Error())
+	})
+}
+
+func TestPartitionedQueue_Drain(t *testing.T) {
+	queue := goext.PartitionedQueue(func(num int) {
+		if num%10 == 0 {
+			panic("something went wrong")
+		}
+	}, func(num int) string {
+		return fmt.Sprint(num % 3)
+	}, goext.QueueOptions{Concurrency: 3, BufferSize: 10})
+
+	for i := 0; i < 100; i++ {
+		queue.Push(i)
+	}
+
+	err := queue.Drain(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, goext.QueueStats{Processed: 90, Failed: 10}, queue.Stats())
+
+	select {
+	case <-queue.Done():
+	default:
+		t.Fatal("Done() should be closed after draining")
+	}
+}
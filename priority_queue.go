@@ -0,0 +1,315 @@
+package goext
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ayonli/goext/clock"
+)
+
+// IPriorityQueue is like `goext.IQueue`, except the data are pushed along with a priority, and
+// data of higher priority are processed first.
+type IPriorityQueue[T any] interface {
+	// Push pushes data with the given priority into the queue, what happens when the queue is
+	// full depends on the queue's overflow policy. It returns `goext.ErrQueueClosed` if the queue
+	// has been closed.
+	Push(data T, priority int) error
+	// TryPush pushes data with the given priority into the queue without blocking, it returns
+	// false if the queue is full or has been closed.
+	TryPush(data T, priority int) bool
+	// PushContext is like Push, but gives up when the context is canceled or its deadline exceeds,
+	// in which case the context's error is returned.
+	PushContext(ctx context.Context, data T, priority int) error
+	Close()
+	// Drain closes the queue and waits until all the data that have been pushed are processed, or
+	// the context is canceled or its deadline exceeds, in which case the context's error is
+	// returned.
+	Drain(ctx context.Context) error
+	// Done returns a channel that is closed once the queue is closed and all the data that have
+	// been pushed are processed.
+	Done() <-chan struct{}
+	// Stats returns the counters of the queue.
+	Stats() QueueStats
+	// OnError sets the handler that is called when the data finally fail to be processed.
+	OnError(handler func(err error))
+	// OnDeadLetter sets the handler that receives the data that finally fail to be processed,
+	// along with the errors of all the attempts.
+	OnDeadLetter(handler func(data T, errs []error))
+}
+
+type priorityItem[T any] struct {
+	data  T
+	score float64 // the priority with aging applied
+	seq   uint64  // keeps FIFO order among equal scores
+}
+
+// priorityItems implements `heap.Interface`, the item of the highest score is at the top.
+type priorityItems[T any] []*priorityItem[T]
+
+func (items priorityItems[T]) Len() int {
+	return len(items)
+}
+
+func (items priorityItems[T]) Less(i, j int) bool {
+	if items[i].score != items[j].score {
+		return items[i].score > items[j].score
+	}
+
+	return items[i].seq < items[j].seq
+}
+
+func (items priorityItems[T]) Swap(i, j int) {
+	items[i], items[j] = items[j], items[i]
+}
+
+func (items *priorityItems[T]) Push(x any) {
+	*items = append(*items, x.(*priorityItem[T]))
+}
+
+func (items *priorityItems[T]) Pop() any {
+	old := *items
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*items = old[:len(old)-1]
+	return item
+}
+
+type PriorityQueueImpl[T any] struct {
+	base     *QueueImpl[T] // provides the workers, the counters and the handlers
+	mut      sync.Mutex
+	items    priorityItems[T]
+	seq      uint64
+	size     int
+	overflow OverflowPolicy
+	aging    time.Duration
+	clock    clock.Clock
+	created  time.Time
+	closed   bool
+	ready    *sync.Cond    // signals the workers that there are items or the queue is closed
+	space    chan struct{} // closed and replaced once an item is taken, to wake up the pushers
+}
+
+func (queue *PriorityQueueImpl[T]) Push(data T, priority int) error {
+	return queue.PushContext(context.Background(), data, priority)
+}
+
+func (queue *PriorityQueueImpl[T]) TryPush(data T, priority int) bool {
+	queue.mut.Lock()
+	defer queue.mut.Unlock()
+
+	if queue.closed || queue.full() {
+		return false
+	}
+
+	queue.add(data, queue.score(priority))
+	return true
+}
+
+func (queue *PriorityQueueImpl[T]) PushContext(ctx context.Context, data T, priority int) error {
+	for {
+		queue.mut.Lock()
+
+		if queue.closed {
+			queue.mut.Unlock()
+			return ErrQueueClosed
+		} else if !queue.full() {
+			queue.add(data, queue.score(priority))
+			queue.mut.Unlock()
+			return nil
+		}
+
+		switch queue.overflow {
+		case OverflowDropNewest:
+			queue.base.dropped.Add(1)
+			queue.mut.Unlock()
+			return nil
+		case OverflowDropOldest:
+			score := queue.score(priority)
+
+			// only make room for the data if they outrank the lowest ones, otherwise, they are the
+			// ones to be dropped
+			if lowest := queue.lowest(); score > queue.items[lowest].score {
+				heap.Remove(&queue.items, lowest)
+				queue.base.pending.Add(-1)
+				queue.add(data, score)
+			}
+
+			queue.base.dropped.Add(1)
+			queue.mut.Unlock()
+			return nil
+		case OverflowError:
+			queue.mut.Unlock()
+			return ErrQueueFull
+		}
+
+		space := queue.space
+		queue.mut.Unlock()
+
+		select {
+		case <-space:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// full reports whether the buffer is full, the caller must hold the lock.
+func (queue *PriorityQueueImpl[T]) full() bool {
+	return queue.size > 0 && len(queue.items) >= queue.size
+}
+
+// score returns the score of the data pushed now with the given priority.
+func (queue *PriorityQueueImpl[T]) score(priority int) float64 {
+	score := float64(priority)
+
+	if queue.aging > 0 {
+		// raising the priority of all waiting items by one every `aging` is equivalent to lowering
+		// the priority of the new item by the time elapsed, which keeps the heap order stable
+		score -= float64(queue.clock.Since(queue.created)) / float64(queue.aging)
+	}
+
+	return score
+}
+
+// add puts the data into the heap, the caller must hold the lock.
+func (queue *PriorityQueueImpl[T]) add(data T, score float64) {
+	queue.seq++
+	queue.base.pending.Add(1)
+	heap.Push(&queue.items, &priorityItem[T]{data: data, score: score, seq: queue.seq})
+	queue.ready.Signal()
+}
+
+// lowest returns the index of the item of the lowest priority, the oldest one among equals, the
+// caller must hold the lock.
+func (queue *PriorityQueueImpl[T]) lowest() int {
+	lowest := 0
+
+	for i, item := range queue.items {
+		if item.score < queue.items[lowest].score ||
+			(item.score == queue.items[lowest].score && item.seq < queue.items[lowest].seq) {
+			lowest = i
+		}
+	}
+
+	return lowest
+}
+
+// pop takes the item of the highest priority, blocking until there is one, it returns false once
+// the queue is closed and empty.
+func (queue *PriorityQueueImpl[T]) pop() (T, bool) {
+	queue.mut.Lock()
+	defer queue.mut.Unlock()
+
+	for len(queue.items) == 0 && !queue.closed {
+		queue.ready.Wait()
+	}
+
+	if len(queue.items) == 0 {
+		return *new(T), false
+	}
+
+	item := heap.Pop(&queue.items).(*priorityItem[T])
+	close(queue.space)
+	queue.space = make(chan struct{})
+
+	return item.data, true
+}
+
+// Close closes the queue, data that have already been pushed will still be processed, but no more
+// data can be pushed. Calling Close multiple times is safe.
+func (queue *PriorityQueueImpl[T]) Close() {
+	queue.mut.Lock()
+	defer queue.mut.Unlock()
+
+	if queue.closed {
+		return
+	}
+
+	queue.closed = true
+	queue.ready.Broadcast()
+	close(queue.space) // wake up pushers that are blocking
+	queue.space = make(chan struct{})
+}
+
+func (queue *PriorityQueueImpl[T]) Drain(ctx context.Context) error {
+	queue.Close()
+
+	select {
+	case <-queue.base.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (queue *PriorityQueueImpl[T]) Done() <-chan struct{} {
+	return queue.base.Done()
+}
+
+func (queue *PriorityQueueImpl[T]) Stats() QueueStats {
+	return queue.base.Stats()
+}
+
+func (queue *PriorityQueueImpl[T]) OnError(handler func(err error)) {
+	queue.base.OnError(handler)
+}
+
+func (queue *PriorityQueueImpl[T]) OnDeadLetter(handler func(data T, errs []error)) {
+	queue.base.OnDeadLetter(handler)
+}
+
+// PriorityQueueOptions configures the queue created by `goext.PriorityQueue()`.
+type PriorityQueueOptions struct {
+	QueueOptions
+	// Aging raises the priority of the waiting data by one every time the given duration passes,
+	// so that data of low priority are not starved by the constantly pushed data of high priority.
+	// By default, the priority never changes.
+	Aging time.Duration
+	// Clock is used to measure the waiting time for `Aging`, default `clock.Real()`.
+	Clock clock.Clock
+}
+
+// PriorityQueue is like `goext.QueueWithOptions()`, except the data are pushed along with a
+// priority, data of higher priority are processed first, and data of the same priority are
+// processed in the order they are pushed.
+//
+// Unlike `goext.Queue()`, `options.BufferSize` is the maximum number of data waiting in the queue,
+// and if not set, the queue is unbounded, since priorities only take effect on the waiting data.
+// When the queue is full, `goext.OverflowDropOldest` discards the data of the lowest priority,
+// the oldest one among equals, or the new data if they don't outrank them.
+//
+// When `options.Concurrency` is greater than 1, the data are still taken in the order of their
+// priorities, but may finish in any order.
+func PriorityQueue[T any](handler func(data T), options PriorityQueueOptions) IPriorityQueue[T] {
+	clk := clock.Or(options.Clock)
+	queue := &PriorityQueueImpl[T]{
+		base: &QueueImpl[T]{
+			retry: options.Retry,
+			done:  make(chan struct{}),
+		},
+		size:     options.BufferSize,
+		overflow: options.Overflow,
+		aging:    options.Aging,
+		clock:    clk,
+		created:  clk.Now(),
+		space:    make(chan struct{}),
+	}
+	queue.ready = sync.NewCond(&queue.mut)
+	queue.base.start(options.Concurrency, func() {
+		for {
+			data, ok := queue.pop()
+
+			if !ok {
+				return
+			}
+
+			queue.base.handle([]T{data}, func() {
+				handler(data)
+			})
+		}
+	})
+
+	return queue
+}
@@ -0,0 +1,196 @@
+package goext_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ayonli/goext"
+	"github.com/ayonli/goext/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func ExamplePriorityQueue() {
+	started := make(chan string, 4)
+	release := make(chan struct{})
+	queue := goext.PriorityQueue(func(job string) {
+		started <- job
+		<-release
+		fmt.Println(job)
+	}, goext.PriorityQueueOptions{})
+
+	queue.Push("first", 0)
+	<-started // wait for the worker to take the first job
+
+	queue.Push("backfill 1", 0)
+	queue.Push("backfill 2", 0)
+	queue.Push("urgent", 10)
+	close(release)
+
+	queue.Drain(context.Background())
+	// Output:
+	// first
+	// urgent
+	// backfill 1
+	// backfill 2
+}
+
+func TestPriorityQueue(suit *testing.T) {
+	suit.Run("order", func(t *testing.T) {
+		out := []int{}
+		started := make(chan int, 7)
+		release := make(chan struct{})
+		queue := goext.PriorityQueue(func(n int) {
+			started <- n
+			<-release
+			out = append(out, n)
+		}, goext.PriorityQueueOptions{})
+
+		queue.Push(0, 100)
+		<-started
+
+		for i, priority := range []int{1, 3, 2, 3, 1, 2} {
+			queue.Push(i+1, priority)
+		}
+
+		close(release)
+		queue.Drain(context.Background())
+		assert.Equal(t, []int{0, 2, 4, 3, 6, 1, 5}, out)
+	})
+
+	suit.Run("Aging", func(t *testing.T) {
+		out := []string{}
+		started := make(chan string, 3)
+		release := make(chan struct{})
+		fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		queue := goext.PriorityQueue(func(str string) {
+			started <- str
+			<-release
+			out = append(out, str)
+		}, goext.PriorityQueueOptions{Aging: time.Millisecond, Clock: fake})
+
+		queue.Push("first", 0)
+		<-started
+
+		queue.Push("low", 0)
+		fake.Advance(time.Millisecond * 6)
+		queue.Push("high", 5) // the low one has waited long enough to outrank it
+
+		close(release)
+		queue.Drain(context.Background())
+		assert.Equal(t, []string{"first", "low", "high"}, out)
+	})
+
+	suit.Run("overflow", func(t *testing.T) {
+		for _, c := range []struct {
+			policy   goext.OverflowPolicy
+			priority int
+			out      []int
+			err      error
+			dropped  int64
+		}{
+			{goext.OverflowDropNewest, 3, []int{0, 2, 1}, nil, 1},
+			{goext.OverflowDropOldest, 3, []int{0, 3, 2}, nil, 1},
+			// the new data don't outrank the lowest ones, so they are dropped instead
+			{goext.OverflowDropOldest, 1, []int{0, 2, 1}, nil, 1},
+			{goext.OverflowError, 3, []int{0, 2, 1}, goext.ErrQueueFull, 0},
+		} {
+			out := []int{}
+			started := make(chan int, 4)
+			release := make(chan struct{})
+			queue := goext.PriorityQueue(func(n int) {
+				started <- n
+				<-release
+				out = append(out, n)
+			}, goext.PriorityQueueOptions{
+				QueueOptions: goext.QueueOptions{BufferSize: 2, Overflow: c.policy},
+			})
+
+			queue.Push(0, 0)
+			<-started
+
+			queue.Push(1, 1)
+			queue.Push(2, 2)
+			assert.Equal(t, c.err, queue.Push(3, c.priority), c.policy)
+			assert.False(t, queue.TryPush(4, 0))
+
+			close(release)
+			queue.Drain(context.Background())
+			assert.Equal(t, c.out, out, c.policy)
+			assert.Equal(t, c.dropped, queue.Stats().Dropped, c.policy)
+		}
+	})
+
+	suit.Run("PushContext", func(t *testing.T) {
+		started := make(chan int, 3)
+		release := make(chan struct{})
+		queue := goext.PriorityQueue(func(n int) {
+			started <- n
+			<-release
+		}, goext.PriorityQueueOptions{
+			QueueOptions: goext.QueueOptions{BufferSize: 1},
+		})
+
+		queue.Push(1, 0)
+		<-started
+		queue.Push(2, 0)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*5)
+		defer cancel()
+		assert.Equal(t, context.DeadlineExceeded, queue.PushContext(ctx, 3, 0))
+
+		// the blocking push proceeds once the worker takes an item
+		go func() {
+			time.Sleep(time.Millisecond * 5)
+			release <- struct{}{}
+		}()
+		assert.Nil(t, queue.Push(3, 0))
+
+		close(release)
+		queue.Drain(context.Background())
+		assert.Equal(t, goext.QueueStats{Processed: 3}, queue.Stats())
+	})
+
+	suit.Run("Close", func(t *testing.T) {
+		queue := goext.PriorityQueue(func(n int) {}, goext.PriorityQueueOptions{})
+		queue.Close()
+		queue.Close()
+
+		<-queue.Done()
+		assert.Equal(t, goext.ErrQueueClosed, queue.Push(1, 0))
+		assert.False(t, queue.TryPush(1, 0))
+	})
+
+	suit.Run("error", func(t *testing.T) {
+		errs := []error{}
+		dead := []int{}
+		queue := goext.PriorityQueue(func(n int) {
+			if n%2 == 0 {
+				panic(errors.New("something went wrong"))
+			}
+		}, goext.PriorityQueueOptions{
+			QueueOptions: goext.QueueOptions{
+				Retry: goext.RetryPolicy{MaxAttempts: 2},
+			},
+		})
+		queue.OnError(func(err error) {
+			errs = append(errs, err)
+		})
+		queue.OnDeadLetter(func(n int, attempts []error) {
+			dead = append(dead, n)
+			assert.Equal(t, 2, len(attempts))
+		})
+
+		for i := 1; i <= 4; i++ {
+			queue.Push(i, 0)
+		}
+
+		queue.Drain(context.Background())
+		assert.Equal(t, 2, len(errs))
+		assert.ErrorContains(t, errs[0], "something went wrong")
+		assert.Equal(t, []int{2, 4}, dead)
+		assert.Equal(t, goext.QueueStats{Processed: 2, Failed: 2}, queue.Stats())
+	})
+}
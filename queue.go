@@ -1,28 +1,249 @@
 package goext
 
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrQueueClosed is returned when pushing data into a queue that has been closed.
+	ErrQueueClosed = errors.New("queue is closed")
+	// ErrQueueFull is returned when pushing data into a queue that is full and its overflow policy
+	// is `goext.OverflowError`.
+	ErrQueueFull = errors.New("queue is full")
+)
+
+// OverflowPolicy decides what happens when pushing data into a queue whose buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the push operation until there is new space available. This is the
+	// default policy.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest discards the data being pushed and returns immediately.
+	OverflowDropNewest
+	// OverflowDropOldest discards the oldest data in the buffer to make room for the new one.
+	OverflowDropOldest
+	// OverflowError returns `goext.ErrQueueFull` immediately.
+	OverflowError
+)
+
 type IQueue[T any] interface {
-	Push(data T)
+	// Push pushes data into the queue, what happens when the queue is full depends on the queue's
+	// overflow policy. It returns `goext.ErrQueueClosed` if the queue has been closed.
+	Push(data T) error
+	// TryPush pushes data into the queue without blocking, it returns false if the queue is full
+	// or has been closed.
+	TryPush(data T) bool
+	// PushContext is like Push, but gives up when the context is canceled or its deadline exceeds,
+	// in which case the context's error is returned.
+	PushContext(ctx context.Context, data T) error
 	Close()
+	// Drain closes the queue and waits until all the data that have been pushed are processed, or
+	// the context is canceled or its deadline exceeds, in which case the context's error is
+	// returned.
+	Drain(ctx context.Context) error
+	// Done returns a channel that is closed once the queue is closed and all the data that have
+	// been pushed are processed.
+	Done() <-chan struct{}
+	// Stats returns the counters of the queue.
+	Stats() QueueStats
+	// OnError sets the handler that is called when the data finally fail to be processed.
 	OnError(handler func(err error))
+	// OnDeadLetter sets the handler that receives the data that finally fail to be processed,
+	// along with the errors of all the attempts.
+	OnDeadLetter(handler func(data T, errs []error))
+}
+
+// QueueStats holds the counters of a queue.
+type QueueStats struct {
+	// Processed is the number of data that have been handled successfully.
+	Processed int64
+	// Failed is the number of data whose handling panicked, after all retries.
+	Failed int64
+	// Pending is the number of data that are either buffered or being handled.
+	Pending int64
+	// Dropped is the number of data discarded by the overflow policy.
+	Dropped int64
 }
 
 type QueueImpl[T any] struct {
-	channel      chan T
-	errorHandler func(err error)
+	channel           chan T
+	errorHandler      func(err error)
+	deadLetterHandler func(data T, errs []error)
+	overflow          OverflowPolicy
+	retry             RetryPolicy
+	mut               sync.RWMutex // guards sending on and closing the channel
+	closed            bool
+	closing           chan struct{}
+	closeOnce         sync.Once
+	workers           sync.WaitGroup
+	done              chan struct{}
+	processed         atomic.Int64
+	failed            atomic.Int64
+	pending           atomic.Int64
+	dropped           atomic.Int64
 }
 
-func (queue *QueueImpl[T]) Push(data T) {
-	queue.channel <- data
+func (queue *QueueImpl[T]) Push(data T) error {
+	return queue.PushContext(context.Background(), data)
 }
 
+func (queue *QueueImpl[T]) TryPush(data T) bool {
+	queue.mut.RLock()
+	defer queue.mut.RUnlock()
+
+	if queue.closed {
+		return false
+	}
+
+	queue.pending.Add(1)
+
+	select {
+	case queue.channel <- data:
+		return true
+	default:
+		queue.pending.Add(-1)
+		return false
+	}
+}
+
+// send sends the data into the channel and keeps the pending counter in sync, the counter is
+// increased ahead of time so that the worker never sees a negative value.
+func (queue *QueueImpl[T]) send(ctx context.Context, data T, block bool) (ok bool, err error) {
+	queue.pending.Add(1)
+
+	if block {
+		select {
+		case queue.channel <- data:
+			return true, nil
+		case <-queue.closing:
+			err = ErrQueueClosed
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	} else {
+		select {
+		case queue.channel <- data:
+			return true, nil
+		default:
+		}
+	}
+
+	queue.pending.Add(-1)
+	return false, err
+}
+
+func (queue *QueueImpl[T]) PushContext(ctx context.Context, data T) error {
+	queue.mut.RLock()
+	defer queue.mut.RUnlock()
+
+	if queue.closed {
+		return ErrQueueClosed
+	}
+
+	switch queue.overflow {
+	case OverflowDropNewest:
+		if ok, _ := queue.send(ctx, data, false); !ok {
+			queue.dropped.Add(1)
+		}
+
+		return nil
+	case OverflowDropOldest:
+		if cap(queue.channel) > 0 {
+			for {
+				if ok, _ := queue.send(ctx, data, false); ok {
+					return nil
+				}
+
+				select {
+				case <-queue.channel: // drop the oldest one
+					queue.pending.Add(-1)
+					queue.dropped.Add(1)
+				default:
+				}
+			}
+		}
+	case OverflowError:
+		if ok, _ := queue.send(ctx, data, false); !ok {
+			return ErrQueueFull
+		}
+
+		return nil
+	}
+
+	_, err := queue.send(ctx, data, true)
+	return err
+}
+
+// Close closes the queue, data that have already been pushed will still be processed, but no more
+// data can be pushed. Calling Close multiple times is safe.
 func (queue *QueueImpl[T]) Close() {
-	close(queue.channel)
+	queue.closeOnce.Do(func() {
+		close(queue.closing) // wake up pushers that are blocking
+
+		queue.mut.Lock()
+		defer queue.mut.Unlock()
+
+		queue.closed = true
+		close(queue.channel)
+	})
+}
+
+func (queue *QueueImpl[T]) Drain(ctx context.Context) error {
+	queue.Close()
+
+	select {
+	case <-queue.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (queue *QueueImpl[T]) Done() <-chan struct{} {
+	return queue.done
+}
+
+func (queue *QueueImpl[T]) Stats() QueueStats {
+	return QueueStats{
+		Processed: queue.processed.Load(),
+		Failed:    queue.failed.Load(),
+		Pending:   queue.pending.Load(),
+		Dropped:   queue.dropped.Load(),
+	}
 }
 
 func (queue *QueueImpl[T]) OnError(handler func(err error)) {
 	queue.errorHandler = handler
 }
 
+func (queue *QueueImpl[T]) OnDeadLetter(handler func(data T, errs []error)) {
+	queue.deadLetterHandler = handler
+}
+
+// QueueOptions configures the queue created by `goext.QueueWithOptions()`.
+type QueueOptions struct {
+	// BufferSize is the maximum capacity of the underlying channel, once reached, the push
+	// operation will act according to the `Overflow` policy. By default, a non-buffered channel
+	// is used.
+	BufferSize int
+	// Concurrency is the number of workers that process the data simultaneously. By default, only
+	// one worker is started and the data is processed sequentially.
+	Concurrency int
+	// Overflow decides what happens when pushing data into a full queue, the default policy is
+	// `goext.OverflowBlock`. `goext.OverflowDropOldest` acts like `goext.OverflowBlock` when the
+	// queue is non-buffered since there is nothing to drop.
+	Overflow OverflowPolicy
+	// Retry sets the policy to retry the data whose handling panicked, by default, no retry is
+	// performed. The worker waits during the backoff, so no other data is processed by it in the
+	// meantime.
+	Retry RetryPolicy
+}
+
 // Queue processes data sequentially by the given `handler` function and prevents concurrency
 // conflicts, it returns a queue instance that we can push data into.
 //
@@ -30,28 +251,103 @@ func (queue *QueueImpl[T]) OnError(handler func(err error)) {
 // operation will block until there is new space available. Bu default, this option is not set and
 // use a non-buffered channel instead.
 func Queue[T any](handler func(data T), bufferSize int) IQueue[T] {
-	queue := &QueueImpl[T]{channel: make(chan T, bufferSize)}
+	return QueueWithOptions(handler, QueueOptions{BufferSize: bufferSize})
+}
 
-	go func() {
-		_, err := Try(func() int {
-			for data := range queue.channel {
-				_, err := Try(func() int {
-					handler(data)
-					return 0
-				})
-
-				if err != nil && queue.errorHandler != nil {
-					queue.errorHandler(err)
-				}
+// QueueWithOptions is like `goext.Queue()`, but allows more options to be set.
+//
+// When `options.Concurrency` is greater than 1, the queue works as a worker pool, where a fixed
+// number of workers pull data from the same channel and run the `handler` function in parallel.
+// In this mode, the order of processing is no longer guaranteed, and the `handler` function is
+// responsible for protecting any shared state itself.
+func QueueWithOptions[T any](handler func(data T), options QueueOptions) IQueue[T] {
+	queue := newQueue[T](options)
+	queue.start(options.Concurrency, func() {
+		for data := range queue.channel {
+			queue.handle([]T{data}, func() {
+				handler(data)
+			})
+		}
+	})
+
+	return queue
+}
+
+func newQueue[T any](options QueueOptions) *QueueImpl[T] {
+	return &QueueImpl[T]{
+		channel:  make(chan T, options.BufferSize),
+		overflow: options.Overflow,
+		retry:    options.Retry,
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// start starts the given number of workers running the `loop` function, the `loop` function
+// should consume the channel until it's closed.
+func (queue *QueueImpl[T]) start(concurrency int, loop func()) {
+	concurrency = max(concurrency, 1)
+	queue.workers.Add(concurrency)
+
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer queue.workers.Done()
+
+			_, err := Try(func() int {
+				loop()
+				return 0
+			})
+
+			if err != nil && queue.errorHandler != nil {
+				queue.errorHandler(err)
 			}
+		}()
+	}
 
+	go func() {
+		queue.workers.Wait()
+		close(queue.done)
+	}()
+}
+
+// handle runs the `call` function which processes the `items` taken from the channel, retries it
+// according to the retry policy, and updates the counters according to its outcome.
+func (queue *QueueImpl[T]) handle(items []T, call func()) {
+	var errs []error
+	delay := time.Duration(0)
+
+	for {
+		_, err := Try(func() int {
+			call()
 			return 0
 		})
 
-		if err != nil && queue.errorHandler != nil {
-			queue.errorHandler(err)
+		if err == nil {
+			queue.processed.Add(int64(len(items)))
+			queue.pending.Add(-int64(len(items)))
+			return
 		}
-	}()
 
-	return queue
+		errs = append(errs, err)
+
+		if !queue.retry.shouldRetry(len(errs), err) {
+			break
+		}
+
+		delay = queue.retry.backoff(len(errs), delay)
+		time.Sleep(delay)
+	}
+
+	queue.failed.Add(int64(len(items)))
+	queue.pending.Add(-int64(len(items)))
+
+	if queue.errorHandler != nil {
+		queue.errorHandler(errs[len(errs)-1])
+	}
+
+	if queue.deadLetterHandler != nil {
+		for _, data := range items {
+			queue.deadLetterHandler(data, errs)
+		}
+	}
 }
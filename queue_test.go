@@ -1,10 +1,15 @@
 package goext_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"testing"
+	"time"
 
 	"github.com/ayonli/goext"
+	"github.com/stretchr/testify/assert"
 )
 
 func ExampleQueue() {
@@ -51,3 +56,419 @@ func ExampleQueue_error() {
 	// Output:
 	// something went wrong
 }
+
+func ExampleQueueWithOptions() {
+	mut := sync.Mutex{}
+	sum := 0
+	queue := goext.QueueWithOptions(func(num int) {
+		// the handler runs in multiple workers, shared state must be protected.
+		mut.Lock()
+		sum += num
+		mut.Unlock()
+	}, goext.QueueOptions{BufferSize: 10, Concurrency: 4})
+
+	for i := 1; i <= 10; i++ {
+		queue.Push(i)
+	}
+
+	queue.Drain(context.Background())
+
+	fmt.Println(sum)
+	// Output:
+	// 55
+}
+
+func TestQueueWithOptions(t *testing.T) {
+	t.Run("concurrency", func(t *testing.T) {
+		started := make(chan int, 3)
+		release := make(chan struct{})
+		queue := goext.QueueWithOptions(func(num int) {
+			started <- num
+			<-release
+		}, goext.QueueOptions{Concurrency: 3})
+		defer queue.Close()
+
+		for i := 0; i < 3; i++ {
+			go queue.Push(i)
+		}
+
+		// all three items must be running at the same time before any of them is released
+		for i := 0; i < 3; i++ {
+			select {
+			case <-started:
+			case <-time.After(time.Second):
+				t.Fatal("workers are not running concurrently")
+			}
+		}
+
+		close(release)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		errs := make(chan error, 2)
+		queue := goext.QueueWithOptions(func(str string) {
+			panic(errors.New(str))
+		}, goext.QueueOptions{Concurrency: 2})
+		defer queue.Close()
+
+		queue.OnError(func(err error) {
+			errs <- err
+		})
+
+		queue.Push("foo")
+		queue.Push("bar")
+
+		messages := []string{(<-errs).Error(), (<-errs).Error()}
+		assert.ElementsMatch(t, []string{"foo", "bar"}, messages)
+	})
+}
+
+func ExampleQueueImpl_TryPush() {
+	release := make(chan struct{})
+	queue := goext.Queue(func(num int) {
+		<-release
+	}, 1)
+	defer queue.Close()
+
+	queue.Push(1) // taken by the worker
+	for !queue.TryPush(2) {
+		// wait until the worker picks up the first item and leaves space in the buffer
+	}
+
+	fmt.Println(queue.TryPush(3)) // buffer is full
+	close(release)
+	// Output:
+	// false
+}
+
+func TestQueue_push(t *testing.T) {
+	t.Run("PushContext", func(t *testing.T) {
+		release := make(chan struct{})
+		queue := goext.Queue(func(num int) {
+			<-release
+		}, 0)
+		defer queue.Close()
+		defer close(release)
+
+		queue.Push(1) // taken by the worker
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*5)
+		defer cancel()
+
+		err := queue.PushContext(ctx, 2)
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		queue := goext.Queue(func(num int) {}, 0)
+		queue.Close()
+		queue.Close() // calling Close multiple times is safe
+
+		assert.Equal(t, goext.ErrQueueClosed, queue.Push(1))
+		assert.Equal(t, goext.ErrQueueClosed, queue.PushContext(context.Background(), 1))
+		assert.False(t, queue.TryPush(1))
+	})
+
+	t.Run("closeWhileBlocking", func(t *testing.T) {
+		release := make(chan struct{})
+		queue := goext.Queue(func(num int) {
+			<-release
+		}, 0)
+		defer close(release)
+
+		queue.Push(1) // taken by the worker
+		out := make(chan error)
+
+		go func() {
+			out <- queue.Push(2)
+		}()
+
+		time.Sleep(time.Millisecond)
+		queue.Close()
+		assert.Equal(t, goext.ErrQueueClosed, <-out)
+	})
+
+	overflow := func(policy goext.OverflowPolicy, last int) ([]int, []error) {
+		release := make(chan struct{})
+		started := make(chan struct{})
+		results := []int{}
+		done := make(chan struct{})
+		queue := goext.QueueWithOptions(func(num int) {
+			if num == 0 {
+				close(started)
+				<-release
+				return
+			}
+
+			results = append(results, num)
+
+			if num == last {
+				close(done)
+			}
+		}, goext.QueueOptions{BufferSize: 2, Overflow: policy})
+		defer queue.Close()
+
+		queue.Push(0)
+		<-started // the worker is busy, now fill the buffer
+
+		errs := []error{}
+
+		for i := 1; i <= 5; i++ {
+			errs = append(errs, queue.Push(i))
+		}
+
+		close(release)
+		<-done
+
+		return results, errs
+	}
+
+	t.Run("OverflowDropNewest", func(t *testing.T) {
+		results, errs := overflow(goext.OverflowDropNewest, 2)
+		assert.Equal(t, []int{1, 2}, results)
+		assert.Equal(t, []error{nil, nil, nil, nil, nil}, errs)
+	})
+
+	t.Run("OverflowDropOldest", func(t *testing.T) {
+		results, errs := overflow(goext.OverflowDropOldest, 5)
+		assert.Equal(t, []int{4, 5}, results)
+		assert.Equal(t, []error{nil, nil, nil, nil, nil}, errs)
+	})
+
+	t.Run("OverflowError", func(t *testing.T) {
+		results, errs := overflow(goext.OverflowError, 2)
+		assert.Equal(t, []int{1, 2}, results)
+		assert.Equal(t, []error{
+			nil, nil, goext.ErrQueueFull, goext.ErrQueueFull, goext.ErrQueueFull,
+		}, errs)
+	})
+}
+
+func ExampleQueueImpl_Drain() {
+	sum := 0
+	queue := goext.Queue(func(num int) {
+		sum += num
+	}, 10)
+
+	for i := 1; i <= 10; i++ {
+		queue.Push(i)
+	}
+
+	// Drain closes the queue and waits until all the data are processed.
+	queue.Drain(context.Background())
+
+	fmt.Println(sum)
+	fmt.Println(queue.Stats().Processed)
+	// Output:
+	// 55
+	// 10
+}
+
+func TestQueue_Drain(t *testing.T) {
+	t.Run("stats", func(t *testing.T) {
+		release := make(chan struct{})
+		queue := goext.QueueWithOptions(func(num int) {
+			<-release
+
+			if num%2 == 0 {
+				panic("something went wrong")
+			}
+		}, goext.QueueOptions{BufferSize: 10, Concurrency: 2})
+
+		for i := 0; i < 10; i++ {
+			queue.Push(i)
+		}
+
+		assert.Equal(t, goext.QueueStats{Pending: 10}, queue.Stats())
+
+		close(release)
+		err := queue.Drain(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, goext.QueueStats{Processed: 5, Failed: 5}, queue.Stats())
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		release := make(chan struct{})
+		queue := goext.Queue(func(num int) {
+			<-release
+		}, 1)
+
+		queue.Push(1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*5)
+		defer cancel()
+
+		err := queue.Drain(ctx)
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.Equal(t, int64(1), queue.Stats().Pending)
+
+		close(release)
+		<-queue.Done()
+		assert.Equal(t, goext.QueueStats{Processed: 1}, queue.Stats())
+	})
+
+	t.Run("dropped", func(t *testing.T) {
+		release := make(chan struct{})
+		started := make(chan struct{})
+		queue := goext.QueueWithOptions(func(num int) {
+			if num == 0 {
+				close(started)
+			}
+
+			<-release
+		}, goext.QueueOptions{BufferSize: 1, Overflow: goext.OverflowDropOldest})
+
+		queue.Push(0)
+		<-started
+
+		for i := 1; i <= 3; i++ {
+			queue.Push(i)
+		}
+
+		assert.Equal(t, goext.QueueStats{Pending: 2, Dropped: 2}, queue.Stats())
+
+		close(release)
+		queue.Drain(context.Background())
+		assert.Equal(t, goext.QueueStats{Processed: 2, Dropped: 2}, queue.Stats())
+	})
+}
+
+func ExampleQueueWithOptions_retry() {
+	attempts := 0
+	queue := goext.QueueWithOptions(func(job string) {
+		attempts++
+		panic(fmt.Errorf("attempt %d failed", attempts))
+	}, goext.QueueOptions{
+		Retry: goext.RetryPolicy{
+			MaxAttempts: 3,
+			Delay:       time.Millisecond,
+			Jitter:      0.5,
+		},
+	})
+
+	queue.OnDeadLetter(func(job string, errs []error) {
+		fmt.Println(job, errs)
+	})
+
+	queue.Push("foo")
+	queue.Drain(context.Background())
+	// Output:
+	// foo [attempt 1 failed attempt 2 failed attempt 3 failed]
+}
+
+func TestQueue_retry(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		attempts := 0
+		deadLetters := 0
+		queue := goext.QueueWithOptions(func(num int) {
+			attempts++
+
+			if attempts < 3 {
+				panic("something went wrong")
+			}
+		}, goext.QueueOptions{
+			Retry: goext.RetryPolicy{MaxAttempts: 5},
+		})
+		queue.OnDeadLetter(func(num int, errs []error) {
+			deadLetters++
+		})
+
+		queue.Push(1)
+		queue.Drain(context.Background())
+
+		assert.Equal(t, 3, attempts)
+		assert.Equal(t, 0, deadLetters)
+		assert.Equal(t, goext.QueueStats{Processed: 1}, queue.Stats())
+	})
+
+	t.Run("backoff", func(t *testing.T) {
+		times := []time.Time{}
+		queue := goext.QueueWithOptions(func(num int) {
+			times = append(times, time.Now())
+			panic("something went wrong")
+		}, goext.QueueOptions{
+			Retry: goext.RetryPolicy{
+				MaxAttempts: 4,
+				Delay:       time.Millisecond * 10,
+				MaxDelay:    time.Millisecond * 15,
+			},
+		})
+
+		queue.Push(1)
+		queue.Drain(context.Background())
+
+		assert.Equal(t, 4, len(times))
+		assert.GreaterOrEqual(t, times[1].Sub(times[0]), time.Millisecond*10)
+		assert.GreaterOrEqual(t, times[2].Sub(times[1]), time.Millisecond*15)
+		assert.GreaterOrEqual(t, times[3].Sub(times[2]), time.Millisecond*15)
+		// without the cap it would be 40ms, the bound leaves a wide margin for slow machines
+		assert.Less(t, times[3].Sub(times[2]), time.Millisecond*35)
+	})
+
+	t.Run("Backoff", func(t *testing.T) {
+		type call struct {
+			attempts int
+			prev     time.Duration
+		}
+
+		calls := []call{}
+		queue := goext.QueueWithOptions(func(num int) {
+			panic("something went wrong")
+		}, goext.QueueOptions{
+			Retry: goext.RetryPolicy{
+				MaxAttempts: 3,
+				Delay:       time.Hour, // ignored since Backoff is set
+				Backoff: func(attempts int, prev time.Duration) time.Duration {
+					calls = append(calls, call{attempts, prev})
+					return prev + time.Millisecond
+				},
+			},
+		})
+
+		queue.Push(1)
+		queue.Drain(context.Background())
+
+		assert.Equal(t, []call{{1, 0}, {2, time.Millisecond}}, calls)
+		assert.Equal(t, goext.QueueStats{Failed: 1}, queue.Stats())
+	})
+
+	t.Run("Retryable", func(t *testing.T) {
+		errFatal := errors.New("fatal")
+		attempts := 0
+		errs := []error{}
+		var deadLetter []error
+		queue := goext.QueueWithOptions(func(num int) {
+			attempts++
+
+			if attempts == 1 {
+				panic(errors.New("temporary"))
+			} else {
+				panic(errFatal)
+			}
+		}, goext.QueueOptions{
+			Retry: goext.RetryPolicy{
+				MaxAttempts: 5,
+				Retryable: func(err error) bool {
+					return !errors.Is(err, errFatal)
+				},
+			},
+		})
+		queue.OnError(func(err error) {
+			errs = append(errs, err)
+		})
+		queue.OnDeadLetter(func(num int, errs []error) {
+			deadLetter = errs
+		})
+
+		queue.Push(1)
+		queue.Drain(context.Background())
+
+		assert.Equal(t, 2, attempts)
+		assert.Equal(t, 1, len(errs))
+		assert.ErrorIs(t, errs[0], errFatal)
+		assert.Equal(t, 2, len(deadLetter))
+		assert.Equal(t, "temporary", deadLetter[0].Error())
+		assert.ErrorIs(t, deadLetter[1], errFatal)
+		assert.Equal(t, goext.QueueStats{Failed: 1}, queue.Stats())
+	})
+}
@@ -0,0 +1,247 @@
+package goext
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ayonli/goext/clock"
+	"github.com/ayonli/goext/collections"
+)
+
+// RateLimitStrategy decides how a rate limiter counts the calls.
+type RateLimitStrategy int
+
+const (
+	// TokenBucket refills `Limit` tokens evenly in every `Interval`, and allows bursts up to
+	// `Burst` calls. This is the default strategy.
+	TokenBucket RateLimitStrategy = iota
+	// SlidingWindow allows at most `Limit` calls in any time window of `Interval`.
+	SlidingWindow
+)
+
+// RateLimiterOptions configures the limiter created by `goext.NewRateLimiter()`.
+type RateLimiterOptions struct {
+	Strategy RateLimitStrategy
+	// Limit is the maximum number of calls allowed in every `Interval`. If not positive, the
+	// limiter allows all calls.
+	Limit int
+	// Interval is the time span of the `Limit`, default 1 second.
+	Interval time.Duration
+	// Burst is the capacity of the token bucket, default `Limit`. It has no effect on the
+	// `SlidingWindow` strategy.
+	Burst int
+	// Clock is used to measure the time, default `clock.Real()`.
+	Clock clock.Clock
+}
+
+// RateLimiter limits how often calls can happen, unlike `goext.Throttle()`, every call that is
+// allowed actually runs.
+type RateLimiter struct {
+	mut     sync.Mutex
+	options RateLimiterOptions
+	clock   clock.Clock
+	// for the token bucket strategy
+	tokens float64
+	last   time.Time
+	// for the sliding window strategy, the time of the recent calls, including reserved ones
+	calls []time.Time
+}
+
+// Reservation is a slot reserved by `RateLimiter.Reserve()`.
+type Reservation struct {
+	limiter *RateLimiter
+	at      time.Time
+}
+
+// NewRateLimiter creates a new rate limiter with the given options.
+func NewRateLimiter(options RateLimiterOptions) *RateLimiter {
+	if options.Interval <= 0 {
+		options.Interval = time.Second
+	}
+
+	if options.Burst <= 0 {
+		options.Burst = options.Limit
+	}
+
+	clk := clock.Or(options.Clock)
+
+	return &RateLimiter{
+		options: options,
+		clock:   clk,
+		tokens:  float64(options.Burst),
+		last:    clk.Now(),
+	}
+}
+
+// refilled returns the number of tokens refilled in the given duration, it multiplies before
+// dividing so that whole intervals refill exact numbers of tokens.
+func (limiter *RateLimiter) refilled(d time.Duration) float64 {
+	return float64(d) * float64(limiter.options.Limit) / float64(limiter.options.Interval)
+}
+
+// refillTime returns the duration it takes to refill the given number of tokens.
+func (limiter *RateLimiter) refillTime(tokens float64) time.Duration {
+	return time.Duration(tokens * float64(limiter.options.Interval) / float64(limiter.options.Limit))
+}
+
+// advance refills the tokens or removes the expired calls up to the given time, the caller must
+// hold the lock.
+func (limiter *RateLimiter) advance(now time.Time) {
+	if limiter.options.Strategy == SlidingWindow {
+		start := now.Add(-limiter.options.Interval)
+		idx := sort.Search(len(limiter.calls), func(i int) bool {
+			return limiter.calls[i].After(start)
+		})
+		limiter.calls = limiter.calls[idx:]
+	} else if now.After(limiter.last) {
+		refilled := limiter.refilled(now.Sub(limiter.last))
+		limiter.tokens = min(float64(limiter.options.Burst), limiter.tokens+refilled)
+		limiter.last = now
+	}
+}
+
+// addCall records a call at the given time for the sliding window strategy, keeping the calls
+// sorted, since reservations may be later than the calls made after them. The caller must hold the
+// lock.
+func (limiter *RateLimiter) addCall(at time.Time) {
+	idx, _ := slices.BinarySearchFunc(limiter.calls, at, time.Time.Compare)
+	limiter.calls = slices.Insert(limiter.calls, idx, at)
+}
+
+// Allow reports whether a call may happen now, if true, the call is counted.
+func (limiter *RateLimiter) Allow() bool {
+	if limiter.options.Limit <= 0 {
+		return true
+	}
+
+	limiter.mut.Lock()
+	defer limiter.mut.Unlock()
+
+	now := limiter.clock.Now()
+	limiter.advance(now)
+
+	if limiter.options.Strategy == SlidingWindow {
+		if len(limiter.calls) < limiter.options.Limit {
+			limiter.addCall(now)
+			return true
+		}
+	} else if limiter.tokens >= 1 {
+		limiter.tokens--
+		return true
+	}
+
+	return false
+}
+
+// Reserve reserves a slot for a call regardless of whether it's available now, and returns a
+// reservation telling how long the caller must wait before the call. If the caller decides not to
+// make the call, it should cancel the reservation.
+func (limiter *RateLimiter) Reserve() *Reservation {
+	now := limiter.clock.Now()
+
+	if limiter.options.Limit <= 0 {
+		return &Reservation{limiter: limiter, at: now}
+	}
+
+	limiter.mut.Lock()
+	defer limiter.mut.Unlock()
+
+	limiter.advance(now)
+	at := now
+
+	if limiter.options.Strategy == SlidingWindow {
+		if count := len(limiter.calls); count >= limiter.options.Limit {
+			at = limiter.calls[count-limiter.options.Limit].Add(limiter.options.Interval)
+		}
+
+		// a reservation may be earlier than the ones made before it when some of them are canceled
+		limiter.addCall(at)
+	} else {
+		limiter.tokens--
+
+		if limiter.tokens < 0 {
+			at = now.Add(limiter.refillTime(-limiter.tokens))
+		}
+	}
+
+	return &Reservation{limiter: limiter, at: at}
+}
+
+// Wait blocks until a call may happen, or the context is canceled or its deadline exceeds, in
+// which case the context's error is returned and nothing is counted.
+func (limiter *RateLimiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	reservation := limiter.Reserve()
+	delay := reservation.Delay()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := limiter.clock.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		reservation.Cancel()
+		return ctx.Err()
+	}
+}
+
+// Delay returns how long the caller must wait before making the call.
+func (reservation *Reservation) Delay() time.Duration {
+	return max(reservation.at.Sub(reservation.limiter.clock.Now()), 0)
+}
+
+// Cancel gives up the reservation so that the slot can be used by other calls. It has no effect
+// if the reserved time has already passed.
+func (reservation *Reservation) Cancel() {
+	limiter := reservation.limiter
+
+	if limiter.options.Limit <= 0 {
+		return
+	}
+
+	limiter.mut.Lock()
+	defer limiter.mut.Unlock()
+
+	now := limiter.clock.Now()
+
+	if !reservation.at.After(now) {
+		return
+	}
+
+	if limiter.options.Strategy == SlidingWindow {
+		if idx := slices.Index(limiter.calls, reservation.at); idx != -1 {
+			limiter.calls = slices.Delete(limiter.calls, idx, idx+1)
+		}
+	} else {
+		limiter.advance(now)
+		limiter.tokens = min(float64(limiter.options.Burst), limiter.tokens+1)
+	}
+}
+
+var rateLimiters = &collections.Map[string, *RateLimiter]{}
+
+// UseRateLimiter returns the rate limiter for the given key from a global registry, creating it
+// with the given options if it doesn't exist yet, so that the calls of the same key, such as a
+// tenant ID, share the same limit. For the same key, only the options of the first call take
+// effect.
+func UseRateLimiter(key string, options RateLimiterOptions) *RateLimiter {
+	return rateLimiters.Use(key, func() *RateLimiter {
+		return NewRateLimiter(options)
+	})
+}
+
+// RemoveRateLimiter removes the rate limiter of the given key from the global registry.
+func RemoveRateLimiter(key string) {
+	rateLimiters.Delete(key)
+}
@@ -0,0 +1,223 @@
+package goext_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ayonli/goext"
+	"github.com/ayonli/goext/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func ExampleRateLimiter_Allow() {
+	limiter := goext.NewRateLimiter(goext.RateLimiterOptions{
+		Limit:    2,
+		Interval: time.Second,
+	})
+
+	fmt.Println(limiter.Allow())
+	fmt.Println(limiter.Allow())
+	fmt.Println(limiter.Allow())
+	// Output:
+	// true
+	// true
+	// false
+}
+
+func ExampleUseRateLimiter() {
+	handle := func(tenant string) bool {
+		limiter := goext.UseRateLimiter("tenant:"+tenant, goext.RateLimiterOptions{
+			Strategy: goext.SlidingWindow,
+			Limit:    1,
+			Interval: time.Second,
+		})
+		return limiter.Allow()
+	}
+
+	fmt.Println(handle("foo"))
+	fmt.Println(handle("foo"))
+	fmt.Println(handle("bar"))
+
+	// remove the limiters once they're no longer needed
+	goext.RemoveRateLimiter("tenant:foo")
+	goext.RemoveRateLimiter("tenant:bar")
+	// Output:
+	// true
+	// false
+	// true
+}
+
+func TestRateLimiter(suit *testing.T) {
+	newClock := func() *clock.Fake {
+		return clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	}
+
+	suit.Run("TokenBucket", func(t *testing.T) {
+		fake := newClock()
+		limiter := goext.NewRateLimiter(goext.RateLimiterOptions{
+			Limit:    1,
+			Interval: time.Millisecond * 10,
+			Burst:    2,
+			Clock:    fake,
+		})
+
+		assert.True(t, limiter.Allow())
+		assert.True(t, limiter.Allow())
+		assert.False(t, limiter.Allow())
+
+		fake.Advance(time.Millisecond * 9)
+		assert.False(t, limiter.Allow())
+
+		fake.Advance(time.Millisecond * 1)
+		assert.True(t, limiter.Allow())
+		assert.False(t, limiter.Allow())
+	})
+
+	suit.Run("SlidingWindow", func(t *testing.T) {
+		fake := newClock()
+		limiter := goext.NewRateLimiter(goext.RateLimiterOptions{
+			Strategy: goext.SlidingWindow,
+			Limit:    2,
+			Interval: time.Millisecond * 20,
+			Clock:    fake,
+		})
+
+		assert.True(t, limiter.Allow())
+		fake.Advance(time.Millisecond * 10)
+		assert.True(t, limiter.Allow())
+		assert.False(t, limiter.Allow())
+
+		fake.Advance(time.Millisecond * 10) // the first call leaves the window
+		assert.True(t, limiter.Allow())
+		assert.False(t, limiter.Allow())
+	})
+
+	suit.Run("SlidingWindowWithReservations", func(t *testing.T) {
+		fake := newClock()
+		limiter := goext.NewRateLimiter(goext.RateLimiterOptions{
+			Strategy: goext.SlidingWindow,
+			Limit:    2,
+			Interval: time.Second * 10,
+			Clock:    fake,
+		})
+
+		assert.True(t, limiter.Allow())
+		assert.True(t, limiter.Allow())
+
+		fake.Advance(time.Second)
+		r1 := limiter.Reserve()
+		r2 := limiter.Reserve()
+		r3 := limiter.Reserve()
+		assert.Equal(t, time.Second*19, r3.Delay())
+
+		fake.Advance(time.Second)
+		r1.Cancel()
+		r2.Cancel()
+
+		// the call made now is earlier than the remaining reservation
+		fake.Advance(time.Millisecond * 8500)
+		assert.True(t, limiter.Allow())
+
+		// the reservation at 20s is still in the window, so only one more call is allowed
+		fake.Advance(time.Millisecond * 10100)
+		assert.True(t, limiter.Allow())
+		assert.False(t, limiter.Allow())
+	})
+
+	suit.Run("Reserve", func(t *testing.T) {
+		for _, strategy := range []goext.RateLimitStrategy{goext.TokenBucket, goext.SlidingWindow} {
+			fake := newClock()
+			limiter := goext.NewRateLimiter(goext.RateLimiterOptions{
+				Strategy: strategy,
+				Limit:    1,
+				Interval: time.Millisecond * 50,
+				Clock:    fake,
+			})
+
+			r1 := limiter.Reserve()
+			r2 := limiter.Reserve()
+			assert.Equal(t, time.Duration(0), r1.Delay())
+			assert.Equal(t, time.Millisecond*50, r2.Delay())
+			assert.False(t, limiter.Allow())
+
+			fake.Advance(time.Millisecond * 10)
+			r2.Cancel()
+			r3 := limiter.Reserve()
+			assert.Equal(t, time.Millisecond*40, r3.Delay())
+		}
+	})
+
+	suit.Run("Wait", func(t *testing.T) {
+		fake := newClock()
+		limiter := goext.NewRateLimiter(goext.RateLimiterOptions{
+			Limit:    1,
+			Interval: time.Millisecond * 10,
+			Clock:    fake,
+		})
+
+		start := fake.Now()
+		done := make(chan struct{})
+
+		go func() {
+			for i := 0; i < 3; i++ {
+				assert.Nil(t, limiter.Wait(context.Background()))
+			}
+
+			close(done)
+		}()
+
+		for i := 0; i < 2; i++ {
+			fake.BlockUntil(1) // wait for the limiter to wait on the clock
+			fake.Advance(time.Millisecond * 10)
+		}
+
+		<-done
+		assert.Equal(t, time.Millisecond*20, fake.Since(start))
+	})
+
+	suit.Run("WaitCanceled", func(t *testing.T) {
+		fake := newClock()
+		limiter := goext.NewRateLimiter(goext.RateLimiterOptions{
+			Limit:    1,
+			Interval: time.Second,
+			Clock:    fake,
+		})
+
+		assert.True(t, limiter.Allow())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		result := make(chan error)
+
+		go func() {
+			result <- limiter.Wait(ctx)
+		}()
+
+		fake.BlockUntil(1)
+		cancel()
+		assert.Equal(t, context.Canceled, <-result)
+
+		// the canceled wait doesn't take the slot
+		assert.Equal(t, time.Second, limiter.Reserve().Delay())
+	})
+
+	suit.Run("unlimited", func(t *testing.T) {
+		limiter := goext.NewRateLimiter(goext.RateLimiterOptions{})
+
+		for i := 0; i < 100; i++ {
+			assert.True(t, limiter.Allow())
+		}
+	})
+
+	suit.Run("RemoveRateLimiter", func(t *testing.T) {
+		options := goext.RateLimiterOptions{Limit: 1, Interval: time.Minute}
+		defer goext.RemoveRateLimiter("remove")
+
+		assert.True(t, goext.UseRateLimiter("remove", options).Allow())
+		assert.False(t, goext.UseRateLimiter("remove", options).Allow())
+
+		goext.RemoveRateLimiter("remove")
+		assert.True(t, goext.UseRateLimiter("remove", options).Allow())
+	})
+}
@@ -1,10 +1,12 @@
 package result_test
 
 import (
+	stderrors "errors"
 	"fmt"
 	"strconv"
 	"testing"
 
+	"github.com/ayonli/goext"
 	"github.com/ayonli/goext/result"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
@@ -77,4 +79,8 @@ func TestTry(t *testing.T) {
 	_, err = mathAdd2("10", "20")
 	assert.Equal(t, "something went wrong", err.Error())
 	assert.Contains(t, fmt.Sprintf("%+v", err), "result_test.withOtherError")
+
+	var panicErr *goext.PanicError
+	assert.True(t, stderrors.As(err, &panicErr))
+	assert.Contains(t, string(panicErr.Stack), "result.Unwrap")
 }
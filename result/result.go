@@ -1,20 +1,16 @@
 package result
 
 import (
-	"errors"
-	"fmt"
+	"github.com/ayonli/goext"
 )
 
+// Try runs a function in a safe context where if it or what's inside it panics, the panic reason
+// can be caught and returned as a `*goext.PanicError`, which keeps the recovered value and the
+// stack of the panic site.
 func Try[T any](fn func() (value T, err error)) (value T, err error) {
 	defer func() {
 		if re := recover(); re != nil {
-			if _err, ok := re.(error); ok {
-				err = _err
-			} else if str, ok := re.(string); ok {
-				err = errors.New(str)
-			} else {
-				err = errors.New(fmt.Sprint(re))
-			}
+			err = goext.NewPanicError(re)
 		}
 	}()
 
@@ -0,0 +1,72 @@
+package goext
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/ayonli/goext/async"
+)
+
+// RetryPolicy decides whether and when a failed call should be retried.
+//
+// Unlike `async.RetryPolicy`, whose zero value makes up to 3 attempts, the zero value of this
+// policy performs no retry, since it's used to opt in to the retries of a queue.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one. If not greater than
+	// 1, no retry will be performed.
+	MaxAttempts int
+	// Backoff computes the duration to wait before each retry, if set, Delay and Multiplier are
+	// ignored. The backoffs of the async package, such as `async.ConstantBackoff()` and
+	// `async.DecorrelatedJitterBackoff()`, can be used here.
+	Backoff async.Backoff
+	// Delay is the backoff duration before the first retry.
+	Delay time.Duration
+	// MaxDelay caps the backoff duration, if not set, the backoff duration grows infinitely.
+	MaxDelay time.Duration
+	// Multiplier is the factor by which the backoff duration grows after each retry. If not greater
+	// than 1, 2 is used, same as `async.ExponentialBackoff()`.
+	Multiplier float64
+	// Jitter is the fraction (between 0 and 1) of the backoff duration to be randomly subtracted,
+	// so that retries of different data don't happen at the same time.
+	Jitter float64
+	// Retryable reports whether the error should be retried, if not set, all errors are retryable.
+	Retryable func(err error) bool
+}
+
+// shouldRetry reports whether another attempt should be made after the given number of attempts
+// failed with the given error.
+func (policy RetryPolicy) shouldRetry(attempts int, err error) bool {
+	if attempts >= policy.MaxAttempts {
+		return false
+	} else if policy.Retryable != nil {
+		return policy.Retryable(err)
+	}
+
+	return true
+}
+
+// backoff returns the duration to wait after the given number of attempts failed, `prev` is the
+// duration returned for the previous retry (0 before the first retry).
+func (policy RetryPolicy) backoff(attempts int, prev time.Duration) time.Duration {
+	backoff := policy.Backoff
+
+	if backoff == nil {
+		backoff = async.ExponentialBackoff(policy.Delay, policy.Multiplier)
+	}
+
+	delay := backoff(attempts, prev)
+
+	// a negative delay can only come from an overflow, so it's treated as capped as well
+	if policy.MaxDelay > 0 && (delay > policy.MaxDelay || delay < 0) {
+		delay = policy.MaxDelay
+	} else if delay < 0 {
+		delay = math.MaxInt64
+	}
+
+	if policy.Jitter > 0 {
+		delay -= time.Duration(float64(delay) * min(policy.Jitter, 1) * rand.Float64())
+	}
+
+	return delay
+}
@@ -2,21 +2,217 @@ package goext
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ayonli/goext/async"
+	"github.com/ayonli/goext/clock"
 	"github.com/ayonli/goext/collections"
 )
 
 type throttleCache[R any] struct {
-	key     string
-	mut     *sync.Mutex
-	expires time.Time
-	result  *async.WaitResult[R]
-	pending *async.AsyncTask[R]
+	key        string
+	mut        *sync.Mutex
+	expires    time.Time
+	result     *async.WaitResult[R]
+	pending    *async.AsyncTask[R]
+	lastAccess time.Time // guarded by the group's lock
+}
+
+// throttleGroup holds the caches of a throttled function, one for each argument key.
+type throttleGroup[R any] struct {
+	mut     sync.Mutex
+	forKey  string
+	caches  map[string]*throttleCache[R]
+	idleTTL time.Duration
+	clock   clock.Clock
+	timer   clock.Timer
+	evicted bool
+}
+
+// throttleEntry is the type-agnostic interface of the groups stored in the global cache.
+type throttleEntry interface {
+	invalidate()
+}
+
+func newThrottleGroup[R any](
+	forKey string,
+	idleTTL time.Duration,
+	clk clock.Clock,
+) *throttleGroup[R] {
+	return &throttleGroup[R]{
+		forKey:  forKey,
+		caches:  map[string]*throttleCache[R]{},
+		idleTTL: idleTTL,
+		clock:   clk,
+	}
+}
+
+// use returns the cache for the given argument key, or nil if the group has been evicted.
+func (group *throttleGroup[R]) use(key string) *throttleCache[R] {
+	group.mut.Lock()
+	defer group.mut.Unlock()
+
+	if group.evicted {
+		return nil
+	}
+
+	cache, ok := group.caches[key]
+
+	if !ok {
+		cache = &throttleCache[R]{key: key, mut: &sync.Mutex{}}
+		group.caches[key] = cache
+	}
+
+	cache.lastAccess = group.clock.Now()
+
+	if group.idleTTL > 0 && group.timer == nil {
+		group.timer = group.clock.AfterFunc(group.idleTTL, group.sweep)
+	}
+
+	return cache
+}
+
+// sweep removes the caches that have been idle for the TTL, and evicts the group from the global
+// cache once all its caches are removed.
+func (group *throttleGroup[R]) sweep() {
+	group.mut.Lock()
+	defer group.mut.Unlock()
+
+	if group.evicted {
+		return
+	}
+
+	now := group.clock.Now()
+	next := group.idleTTL
+
+	for key, cache := range group.caches {
+		if idle := now.Sub(cache.lastAccess); idle >= group.idleTTL {
+			delete(group.caches, key)
+		} else {
+			next = min(next, group.idleTTL-idle)
+		}
+	}
+
+	if len(group.caches) > 0 {
+		group.timer = group.clock.AfterFunc(next, group.sweep)
+	} else {
+		group.timer = nil
+
+		if group.forKey != "" {
+			group.evicted = true
+			go removeThrottleGroup(group.forKey, group)
+		}
+	}
+}
+
+func (group *throttleGroup[R]) isEvicted() bool {
+	group.mut.Lock()
+	defer group.mut.Unlock()
+	return group.evicted
+}
+
+func (group *throttleGroup[R]) invalidate() {
+	group.mut.Lock()
+	defer group.mut.Unlock()
+
+	if group.timer != nil {
+		group.timer.Stop()
+		group.timer = nil
+	}
+
+	group.evicted = true
+	group.caches = map[string]*throttleCache[R]{}
 }
 
 var throttleCaches = &collections.Map[string, any]{}
+var throttleMut sync.Mutex // guards the lookup and removal of the entries in `throttleCaches`
+
+func useThrottleGroup[R any](
+	forKey string,
+	idleTTL time.Duration,
+	clk clock.Clock,
+) *throttleGroup[R] {
+	throttleMut.Lock()
+	defer throttleMut.Unlock()
+
+	if current, ok := throttleCaches.Get(forKey); ok {
+		group := current.(*throttleGroup[R])
+
+		// an evicted group may still be stored until its removal goroutine runs, replace it so
+		// that the callers don't keep picking it up
+		if !group.isEvicted() {
+			return group
+		}
+	}
+
+	group := newThrottleGroup[R](forKey, idleTTL, clk)
+	throttleCaches.Set(forKey, group)
+	return group
+}
+
+// removeThrottleGroup removes the group from the global cache if it's still the one stored for
+// the key.
+func removeThrottleGroup(forKey string, group throttleEntry) {
+	throttleMut.Lock()
+	defer throttleMut.Unlock()
+
+	if current, ok := throttleCaches.Get(forKey); ok && current == group {
+		throttleCaches.Delete(forKey)
+	}
+}
+
+// InvalidateThrottle removes the cached results of the throttled functions created with the given
+// `forKey`, the next call of them will invoke the handler function again.
+func InvalidateThrottle(forKey string) {
+	throttleMut.Lock()
+	group, ok := throttleCaches.Pop(forKey)
+	throttleMut.Unlock()
+
+	if ok {
+		group.(throttleEntry).invalidate()
+	}
+}
+
+// PurgeThrottles removes all the cached results of the throttled functions created with a
+// `forKey`.
+func PurgeThrottles() {
+	throttleMut.Lock()
+	groups := throttleCaches.Values()
+	throttleCaches.Clear()
+	throttleMut.Unlock()
+
+	for _, group := range groups {
+		group.(throttleEntry).invalidate()
+	}
+}
+
+// ThrottleOptions configures the throttled function created by `goext.ThrottleWithOptions()`.
+type ThrottleOptions[A any] struct {
+	// Duration is the time window in which subsequent calls reuse the previous result.
+	Duration time.Duration
+	// ForKey keeps the result in a global cache for the given key, see `goext.Throttle()`.
+	ForKey string
+	// NoWait responds with the last cache immediately and updates it in the background, see
+	// `goext.Throttle()`.
+	NoWait bool
+	// Key derives a cache key from the argument, so that the results are cached per argument.
+	// By default, all calls share the same result regardless of the argument.
+	Key func(arg A) string
+	// NoCacheError prevents failed results from being cached, so that the next call invokes the
+	// handler function again. Concurrent calls waiting for the same pending call still share its
+	// error. If there is a previous successful result, `NoWait` keeps responding with it.
+	NoCacheError bool
+	// IdleTTL removes the cached result of an argument key once it hasn't been accessed for the
+	// given duration, and removes the `ForKey` entry from the global cache once all its results
+	// are removed. By default, cached results are kept forever. For the same `ForKey`, only the
+	// option of the first created function takes effect.
+	IdleTTL time.Duration
+	// Clock provides the time for the expiration of the results, default `clock.Real()`. A fake
+	// clock can be used in tests to expire the results without waiting for the real time to pass.
+	// For the same `ForKey`, the idle removal keeps using the clock of the first created function.
+	Clock clock.Clock
+}
 
 // Creates a throttled function that will only be run once in a certain amount of time.
 //
@@ -36,11 +232,30 @@ func Throttle[A any, R any, Fn func(arg A) (R, error)](
 	forKey string,
 	noWait bool,
 ) Fn {
+	return ThrottleWithOptions[A, R, Fn](handler, ThrottleOptions[A]{
+		Duration: duration,
+		ForKey:   forKey,
+		NoWait:   noWait,
+	})
+}
+
+// ThrottleWithOptions is like `goext.Throttle()`, but allows more options to be set.
+//
+// If `options.Key` is provided, the results are cached per argument key, calls with different
+// keys don't affect each other, while each of them follows the same throttle strategy, including
+// the `NoWait` behavior.
+func ThrottleWithOptions[A any, R any, Fn func(arg A) (R, error)](
+	handler Fn,
+	options ThrottleOptions[A],
+) Fn {
+	duration := options.Duration
+	noWait := options.NoWait
+	clk := clock.Or(options.Clock)
 	handleCall := func(cache *throttleCache[R], arg A) (R, error) {
 		cache.mut.Lock()
 		defer cache.mut.Unlock()
 
-		if cache.result != nil && ((cache.pending != nil && noWait) || cache.expires.After(time.Now())) {
+		if cache.result != nil && ((cache.pending != nil && noWait) || cache.expires.After(clk.Now())) {
 			if cache.result.Error != nil {
 				return *new(R), cache.result.Error
 			} else {
@@ -62,37 +277,60 @@ func Throttle[A any, R any, Fn func(arg A) (R, error)](
 			}
 		}()
 
-		waitUpdate := func() {
+		waitUpdate := func() (R, error) {
 			val, err := cache.pending.Result()
-			cache.result = &async.WaitResult[R]{Value: val, Error: err}
-			cache.expires = time.Now().Add(duration)
 			cache.pending = nil
+
+			if err == nil || !options.NoCacheError {
+				cache.result = &async.WaitResult[R]{Value: val, Error: err}
+				cache.expires = clk.Now().Add(duration)
+			}
+
+			return val, err
 		}
 
 		if noWait && cache.result != nil {
+			result := cache.result
+
 			go func() {
 				cache.mut.Lock()
 				defer cache.mut.Unlock()
 				waitUpdate()
 			}()
+
+			return result.Value, result.Error
 		} else {
-			waitUpdate()
+			return waitUpdate()
 		}
-
-		return cache.result.Value, cache.result.Error
 	}
 
-	var cache *throttleCache[R]
-
-	if forKey == "" {
-		cache = &throttleCache[R]{key: "", mut: &sync.Mutex{}}
-	} else {
-		cache = (throttleCaches.Use(forKey, func() any {
-			return any(&throttleCache[R]{key: forKey, mut: &sync.Mutex{}})
-		})).(*throttleCache[R])
+	resolveGroup := func() *throttleGroup[R] {
+		if options.ForKey == "" {
+			return newThrottleGroup[R]("", options.IdleTTL, clk)
+		} else {
+			return useThrottleGroup[R](options.ForKey, options.IdleTTL, clk)
+		}
 	}
 
+	group := &atomic.Pointer[throttleGroup[R]]{}
+	group.Store(resolveGroup())
+
 	return func(arg A) (R, error) {
-		return handleCall(cache, arg)
+		key := ""
+
+		if options.Key != nil {
+			key = options.Key(arg)
+		}
+
+		for {
+			current := group.Load()
+
+			if cache := current.use(key); cache != nil {
+				return handleCall(cache, arg)
+			}
+
+			// the group has been evicted from the global cache, pick up the new one
+			group.CompareAndSwap(current, resolveGroup())
+		}
 	}
 }
@@ -7,18 +7,36 @@ import (
 	"time"
 
 	"github.com/ayonli/goext"
+	"github.com/ayonli/goext/clock"
 	"github.com/stretchr/testify/assert"
 )
 
-func ExampleThrottle_withoutKey() {
+func ExampleThrottle() {
 	fn := goext.Throttle[int](func(arg int) (int, error) {
 		return arg * 2, nil
-	}, time.Millisecond*5, "", false)
+	}, time.Second, "", false)
+
+	fmt.Println(fn(1))
+	fmt.Println(fn(2)) // throttled, the cached result is returned
+
+	// Output:
+	// 2 <nil>
+	// 2 <nil>
+}
+
+func ExampleThrottleWithOptions_withoutKey() {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	fn := goext.ThrottleWithOptions[int](func(arg int) (int, error) {
+		return arg * 2, nil
+	}, goext.ThrottleOptions[int]{
+		Duration: time.Millisecond * 5,
+		Clock:    fake,
+	})
 
 	fmt.Println(fn(1))
 	fmt.Println(fn(2))
 
-	time.Sleep(time.Millisecond * 6)
+	fake.Advance(time.Millisecond * 5)
 	fmt.Println(fn(3))
 
 	// Output:
@@ -27,21 +45,26 @@ func ExampleThrottle_withoutKey() {
 	// 6 <nil>
 }
 
-func ExampleThrottle_withKey() {
-	res1, err1 := goext.Throttle[int](func(arg int) (int, error) {
-		return arg * 2, nil
-	}, time.Millisecond*5, "foo", false)(1)
-	res2, err2 := goext.Throttle[int](func(arg int) (int, error) {
-		return arg * 2, nil
-	}, time.Millisecond*5, "foo", false)(2)
+func ExampleThrottleWithOptions_withForKey() {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	defer goext.InvalidateThrottle("foo")
+	newFn := func() func(arg int) (int, error) {
+		return goext.ThrottleWithOptions[int](func(arg int) (int, error) {
+			return arg * 2, nil
+		}, goext.ThrottleOptions[int]{
+			Duration: time.Millisecond * 5,
+			ForKey:   "foo",
+			Clock:    fake,
+		})
+	}
 
+	res1, err1 := newFn()(1)
+	res2, err2 := newFn()(2) // shares the cache with the first function
 	fmt.Println(res1, err1)
 	fmt.Println(res2, err2)
 
-	time.Sleep(time.Millisecond * 6)
-	res3, err3 := goext.Throttle[int](func(arg int) (int, error) {
-		return arg * 2, nil
-	}, time.Millisecond*5, "foo", false)(3)
+	fake.Advance(time.Millisecond * 5)
+	res3, err3 := newFn()(3)
 	fmt.Println(res3, err3)
 
 	// Output:
@@ -50,69 +73,309 @@ func ExampleThrottle_withKey() {
 	// 6 <nil>
 }
 
+func ExampleThrottleWithOptions() {
+	fn := goext.ThrottleWithOptions[int](func(arg int) (int, error) {
+		return arg * 2, nil
+	}, goext.ThrottleOptions[int]{
+		Duration: time.Millisecond * 5,
+		Key: func(arg int) string {
+			return fmt.Sprint(arg)
+		},
+	})
+
+	fmt.Println(fn(1))
+	fmt.Println(fn(2)) // different argument, different result
+	fmt.Println(fn(1))
+
+	// Output:
+	// 2 <nil>
+	// 4 <nil>
+	// 2 <nil>
+}
+
 func TestThrottle(suit *testing.T) {
+	newClock := func() *clock.Fake {
+		return clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	}
+	handler := func(arg int) (int, error) {
+		if arg == 1 {
+			return 0, errors.New("something went wrong")
+		} else {
+			return 0, errors.New("something else went wrong")
+		}
+	}
+
 	suit.Run("failedWithoutKey", func(t *testing.T) {
-		fn := goext.Throttle[int](func(arg int) (int, error) {
-			if arg == 1 {
-				return 0, errors.New("something went wrong")
-			} else {
-				return 0, errors.New("something else went wrong")
-			}
-		}, time.Millisecond*5, "", false)
+		fake := newClock()
+		fn := goext.ThrottleWithOptions[int](handler, goext.ThrottleOptions[int]{
+			Duration: time.Millisecond * 5,
+			Clock:    fake,
+		})
 
 		_, err1 := fn(1)
 		_, err2 := fn(2)
 		assert.Equal(t, errors.New("something went wrong"), err1)
 		assert.Equal(t, err1, err2)
 
-		time.Sleep(time.Millisecond * 6)
+		fake.Advance(time.Millisecond * 5)
 		_, err3 := fn(2)
 		assert.Equal(t, errors.New("something else went wrong"), err3)
 	})
 
 	suit.Run("failedWithKey", func(t *testing.T) {
-		_, err1 := goext.Throttle[int](func(arg int) (int, error) {
-			if arg == 1 {
-				return 0, errors.New("something went wrong")
-			} else {
-				return 0, errors.New("something else went wrong")
-			}
-		}, time.Millisecond*5, "bar", false)(1)
-		_, err2 := goext.Throttle[int](func(arg int) (int, error) {
-			if arg == 1 {
-				return 0, errors.New("something went wrong")
-			} else {
-				return 0, errors.New("something else went wrong")
-			}
-		}, time.Millisecond*5, "bar", false)(2)
+		fake := newClock()
+		defer goext.InvalidateThrottle("bar")
+		options := goext.ThrottleOptions[int]{
+			Duration: time.Millisecond * 5,
+			ForKey:   "bar",
+			Clock:    fake,
+		}
 
+		_, err1 := goext.ThrottleWithOptions[int](handler, options)(1)
+		_, err2 := goext.ThrottleWithOptions[int](handler, options)(2)
 		assert.Equal(t, errors.New("something went wrong"), err1)
 		assert.Equal(t, err1, err2)
 
-		time.Sleep(time.Millisecond * 6)
-		_, err3 := goext.Throttle[int](func(arg int) (int, error) {
-			if arg == 1 {
-				return 0, errors.New("something went wrong")
-			} else {
-				return 0, errors.New("something else went wrong")
-			}
-		}, time.Millisecond*5, "bar", false)(2)
+		fake.Advance(time.Millisecond * 5)
+		_, err3 := goext.ThrottleWithOptions[int](handler, options)(2)
 		assert.Equal(t, errors.New("something else went wrong"), err3)
 	})
 
 	suit.Run("noWait", func(t *testing.T) {
-		fn := goext.Throttle[int](func(arg int) (int, error) {
+		fake := newClock()
+		fn := goext.ThrottleWithOptions[int](func(arg int) (int, error) {
 			return arg * 2, nil
-		}, time.Millisecond*5, "", true)
+		}, goext.ThrottleOptions[int]{
+			Duration: time.Millisecond * 5,
+			NoWait:   true,
+			Clock:    fake,
+		})
 
 		res1, _ := fn(1)
 
-		time.Sleep(time.Millisecond * 6)
-		res2, _ := fn(2)
+		fake.Advance(time.Millisecond * 5)
+		res2, _ := fn(2) // responds with the last result and updates it in the background
 		assert.Equal(t, res2, res1)
 
-		time.Sleep(time.Millisecond)
+		assert.Eventually(t, func() bool {
+			res3, _ := fn(3)
+			return res3 == 4
+		}, time.Second, time.Millisecond)
+	})
+}
+
+func TestThrottleWithOptions(suit *testing.T) {
+	suit.Run("Key", func(t *testing.T) {
+		calls := 0
+		fake := clock.NewFake(time.Now())
+		fn := goext.ThrottleWithOptions[string](func(arg string) (string, error) {
+			calls++
+			return arg + fmt.Sprint(calls), nil
+		}, goext.ThrottleOptions[string]{
+			Duration: time.Millisecond * 5,
+			Key: func(arg string) string {
+				return arg
+			},
+			Clock: fake,
+		})
+
+		res1, _ := fn("foo")
+		res2, _ := fn("bar")
+		res3, _ := fn("foo")
+		assert.Equal(t, "foo1", res1)
+		assert.Equal(t, "bar2", res2)
+		assert.Equal(t, "foo1", res3)
+
+		fake.Advance(time.Millisecond * 5)
+		res4, _ := fn("foo")
+		assert.Equal(t, "foo3", res4)
+	})
+
+	suit.Run("KeyWithForKey", func(t *testing.T) {
+		options := goext.ThrottleOptions[int]{
+			Duration: time.Millisecond * 5,
+			ForKey:   "perArgument",
+			Key: func(arg int) string {
+				return fmt.Sprint(arg % 2)
+			},
+		}
+
+		res1, _ := goext.ThrottleWithOptions[int](func(arg int) (int, error) {
+			return arg, nil
+		}, options)(1)
+		res2, _ := goext.ThrottleWithOptions[int](func(arg int) (int, error) {
+			return arg * 10, nil
+		}, options)(3)
+		res3, _ := goext.ThrottleWithOptions[int](func(arg int) (int, error) {
+			return arg * 10, nil
+		}, options)(2)
+
+		assert.Equal(t, 1, res1)
+		assert.Equal(t, 1, res2) // same key as 1
+		assert.Equal(t, 20, res3)
+	})
+
+	suit.Run("KeyWithNoWait", func(t *testing.T) {
+		fake := clock.NewFake(time.Now())
+		fn := goext.ThrottleWithOptions[int](func(arg int) (int, error) {
+			return arg * 2, nil
+		}, goext.ThrottleOptions[int]{
+			Duration: time.Millisecond * 5,
+			NoWait:   true,
+			Key: func(arg int) string {
+				return fmt.Sprint(arg % 2)
+			},
+			Clock: fake,
+		})
+
+		res1, _ := fn(1)
+		res2, _ := fn(2)
+		assert.Equal(t, 2, res1)
+		assert.Equal(t, 4, res2)
+
+		fake.Advance(time.Millisecond * 5)
 		res3, _ := fn(3)
-		assert.Equal(t, res3, 4)
+		assert.Equal(t, 2, res3) // stale result, updating in the background
+
+		assert.Eventually(t, func() bool {
+			res4, _ := fn(5)
+			return res4 == 6
+		}, time.Second, time.Millisecond)
+	})
+}
+
+func ExampleInvalidateThrottle() {
+	fn := func(arg int) (int, error) {
+		return goext.Throttle[int](func(arg int) (int, error) {
+			return arg * 2, nil
+		}, time.Minute, "invalidateExample", false)(arg)
+	}
+
+	fmt.Println(fn(1))
+	fmt.Println(fn(2))
+
+	goext.InvalidateThrottle("invalidateExample")
+	fmt.Println(fn(3))
+
+	// Output:
+	// 2 <nil>
+	// 2 <nil>
+	// 6 <nil>
+}
+
+func TestThrottle_eviction(suit *testing.T) {
+	suit.Run("InvalidateThrottle", func(t *testing.T) {
+		calls := 0
+		fn := goext.Throttle[int](func(arg int) (int, error) {
+			calls++
+			return arg, nil
+		}, time.Minute, "invalidate", false)
+
+		res1, _ := fn(1)
+		res2, _ := fn(2)
+		assert.Equal(t, 1, res1)
+		assert.Equal(t, 1, res2)
+
+		// the function created before the invalidation picks up the new cache
+		goext.InvalidateThrottle("invalidate")
+		res3, _ := fn(3)
+		res4, _ := fn(4)
+		assert.Equal(t, 3, res3)
+		assert.Equal(t, 3, res4)
+		assert.Equal(t, 2, calls)
+
+		// and shares it with the new function of the same key
+		res5, _ := goext.Throttle[int](func(arg int) (int, error) {
+			return arg, nil
+		}, time.Minute, "invalidate", false)(5)
+		assert.Equal(t, 3, res5)
+
+		goext.InvalidateThrottle("nonExistent") // no effect
+	})
+
+	suit.Run("PurgeThrottles", func(t *testing.T) {
+		fn1 := goext.Throttle[int](func(arg int) (int, error) {
+			return arg, nil
+		}, time.Minute, "purge1", false)
+		fn2 := goext.Throttle[int](func(arg int) (int, error) {
+			return arg, nil
+		}, time.Minute, "purge2", false)
+
+		fn1(1)
+		fn2(1)
+		goext.PurgeThrottles()
+
+		res1, _ := fn1(2)
+		res2, _ := fn2(3)
+		assert.Equal(t, 2, res1)
+		assert.Equal(t, 3, res2)
+	})
+
+	suit.Run("IdleTTL", func(t *testing.T) {
+		calls := 0
+		fake := clock.NewFake(time.Now())
+		options := goext.ThrottleOptions[int]{
+			Duration: time.Minute,
+			ForKey:   "idleTTL",
+			IdleTTL:  time.Millisecond * 10,
+			Key: func(arg int) string {
+				return fmt.Sprint(arg)
+			},
+			Clock: fake,
+		}
+		fn := goext.ThrottleWithOptions[int](func(arg int) (int, error) {
+			calls++
+			return calls, nil
+		}, options)
+
+		res1, _ := fn(1)
+		fn(2)
+
+		// keep key 1 alive while key 2 becomes idle
+		for i := 0; i < 3; i++ {
+			fake.Advance(time.Millisecond * 5)
+			res, _ := fn(1)
+			assert.Equal(t, res1, res)
+		}
+
+		res2, _ := fn(2)
+		assert.Equal(t, 3, res2)
+
+		// all keys become idle, the entry is removed from the global cache
+		fake.Advance(time.Millisecond * 30)
+		res3, _ := goext.ThrottleWithOptions[int](func(arg int) (int, error) {
+			return -1, nil
+		}, options)(1)
+		res4, _ := fn(1)
+		assert.Equal(t, -1, res3)
+		assert.Equal(t, -1, res4)
+	})
+
+	suit.Run("NoCacheError", func(t *testing.T) {
+		calls := 0
+		fn := goext.ThrottleWithOptions[int](func(arg int) (int, error) {
+			calls++
+
+			if arg < 0 {
+				return 0, errors.New("something went wrong")
+			}
+
+			return arg, nil
+		}, goext.ThrottleOptions[int]{
+			Duration:     time.Minute,
+			NoCacheError: true,
+		})
+
+		_, err1 := fn(-1)
+		_, err2 := fn(-2)
+		res3, err3 := fn(3)
+		res4, _ := fn(4)
+
+		assert.Equal(t, errors.New("something went wrong"), err1)
+		assert.Equal(t, errors.New("something went wrong"), err2)
+		assert.Nil(t, err3)
+		assert.Equal(t, 3, res3)
+		assert.Equal(t, 3, res4)
+		assert.Equal(t, 3, calls)
 	})
 }